@@ -0,0 +1,37 @@
+package common
+
+import "math"
+
+// TrapezoidDuration returns how many seconds a trapezoidal move takes to travel distance, starting
+// and ending at rest, with a top speed of velocity and the given acceleration and deceleration.
+// The units just need to agree with each other (e.g., revolutions, revs/sec and revs/sec^2). An
+// acceleration or deceleration of 0 is treated as instantaneous. If the move is too short to reach
+// the top speed, the profile is a triangle instead.
+func TrapezoidDuration(distance, velocity, accel, decel float64) float64 {
+	distance = math.Abs(distance)
+	if distance == 0 {
+		return 0
+	}
+	if velocity <= 0 {
+		return math.Inf(1)
+	}
+
+	// Time and distance spent on each ramp, if we get all the way up to speed.
+	rampTime := func(rate float64) float64 {
+		if rate <= 0 {
+			return 0
+		}
+		return velocity / rate
+	}
+	accelTime, decelTime := rampTime(accel), rampTime(decel)
+	rampDistance := velocity * (accelTime + decelTime) / 2
+
+	if rampDistance <= distance {
+		return accelTime + decelTime + (distance-rampDistance)/velocity
+	}
+
+	// We never reach full speed. Both ramps are still non-instantaneous here (otherwise the ramp
+	// distance would be 0), so we can find the peak velocity of the triangle directly.
+	peak := math.Sqrt(2 * distance * accel * decel / (accel + decel))
+	return peak/accel + peak/decel
+}
@@ -0,0 +1,24 @@
+package common
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrapezoidDuration(t *testing.T) {
+	// 1 second to get up to speed (0.5 revs), 1 second to slow down (0.5 revs), and 9 revs at
+	// full speed in between.
+	assert.InDelta(t, 11.0, TrapezoidDuration(10, 1, 1, 1), 1e-9)
+	assert.InDelta(t, 11.0, TrapezoidDuration(-10, 1, 1, 1), 1e-9)
+
+	// Instantaneous acceleration and deceleration
+	assert.InDelta(t, 10.0, TrapezoidDuration(10, 1, 0, 0), 1e-9)
+
+	// Too short to reach full speed: a triangle peaking at 1 rev/sec after 1 second.
+	assert.InDelta(t, 2.0, TrapezoidDuration(1, 100, 1, 1), 1e-9)
+
+	assert.Equal(t, 0.0, TrapezoidDuration(0, 1, 1, 1))
+	assert.True(t, math.IsInf(TrapezoidDuration(1, 0, 1, 1), 1))
+}
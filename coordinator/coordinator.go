@@ -0,0 +1,146 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.uber.org/multierr"
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/generic"
+)
+
+var Model = resource.NewModel("viam", "appliedmotion", "st-coordinator")
+
+// AxisConfig is how one motor would move on its own. Like the positions in a move, the speed and
+// acceleration are in the motor's user units, so rpm is user units per minute and the acceleration
+// and deceleration are user units per second squared.
+type AxisConfig struct {
+	Motor        string  `json:"motor"`
+	Rpm          float64 `json:"rpm"`
+	Acceleration float64 `json:"accel_per_sec_squared,omitempty"`
+	Deceleration float64 `json:"decel_per_sec_squared,omitempty"`
+}
+
+type Config struct {
+	Axes []AxisConfig `json:"axes"`
+}
+
+// Validate ensures all parts of the config are valid.
+func (conf *Config) Validate(path string) ([]string, error) {
+	if len(conf.Axes) == 0 {
+		return nil, errors.New("at least one axis is required")
+	}
+	var deps []string
+	for i, axis := range conf.Axes {
+		if axis.Motor == "" {
+			return nil, fmt.Errorf("axis %d: motor is required", i)
+		}
+		if axis.Rpm <= 0 {
+			return nil, fmt.Errorf("axis %d: rpm must be > 0", i)
+		}
+		if axis.Acceleration < 0 || axis.Deceleration < 0 {
+			return nil, fmt.Errorf("axis %d: acceleration and deceleration must be >= 0", i)
+		}
+		deps = append(deps, axis.Motor)
+	}
+	return deps, nil
+}
+
+type coordinator struct {
+	resource.Named
+	resource.AlwaysRebuild
+	resource.TriviallyCloseable
+	mu     sync.Mutex
+	logger logging.Logger
+	axes   []Axis
+}
+
+func init() {
+	resource.RegisterService(
+		generic.API,
+		Model,
+		resource.Registration[resource.Resource, *Config]{Constructor: newCoordinator})
+}
+
+func newCoordinator(
+	ctx context.Context, deps resource.Dependencies, conf resource.Config, logger logging.Logger,
+) (resource.Resource, error) {
+	newConf, err := resource.NativeConfig[*Config](conf)
+	if err != nil {
+		return nil, err
+	}
+
+	c := coordinator{
+		Named:  conf.ResourceName().AsNamed(),
+		logger: logger,
+	}
+	for _, axisConf := range newConf.Axes {
+		m, err := motor.FromDependencies(deps, axisConf.Motor)
+		if err != nil {
+			return nil, err
+		}
+		c.axes = append(c.axes, Axis{
+			Name:         axisConf.Motor,
+			Motor:        m,
+			Rpm:          axisConf.Rpm,
+			Acceleration: axisConf.Acceleration,
+			Deceleration: axisConf.Deceleration,
+		})
+	}
+	return &c, nil
+}
+
+// DoCommand supports {"move": {"<motor>": <position>, ...}}, which moves the named motors to the
+// given positions (in each motor's user units) so that they all arrive at the same time, and {"stop": true},
+// which stops every motor in the group.
+func (c *coordinator) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	if _, ok := cmd["stop"]; ok {
+		var err error
+		for _, axis := range c.axes {
+			err = multierr.Combine(err, axis.Motor.Stop(ctx, nil))
+		}
+		return map[string]interface{}{}, err
+	}
+
+	if val, ok := cmd["move"]; ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		positions, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("move must be a map from motor name to position, got %#v", val)
+		}
+		var axes []Axis
+		var targets []float64
+		for name, position := range positions {
+			axis, err := c.axis(name)
+			if err != nil {
+				return nil, err
+			}
+			target, ok := position.(float64)
+			if !ok {
+				return nil, fmt.Errorf("position for %s must be a number, got %#v", name, position)
+			}
+			axes = append(axes, axis)
+			targets = append(targets, target)
+		}
+		c.logger.Debugf("Coordinated move to %v", positions)
+		duration, err := Move(ctx, axes, targets)
+		return map[string]interface{}{"duration_sec": duration}, err
+	}
+
+	return nil, resource.ErrDoUnimplemented
+}
+
+func (c *coordinator) axis(name string) (Axis, error) {
+	for _, axis := range c.axes {
+		if axis.Name == name {
+			return axis, nil
+		}
+	}
+	return Axis{}, fmt.Errorf("%s is not one of this coordinator's motors", name)
+}
@@ -0,0 +1,124 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"go.uber.org/multierr"
+	"go.viam.com/rdk/components/motor"
+
+	"viam/viam-appliedmotion/common"
+)
+
+// Axis is one motor taking part in a coordinated move, along with the speed and acceleration it
+// would use if it were moving on its own. An acceleration or deceleration of 0 means to use
+// whatever the motor is already set to, which we then can't account for when planning. Extra is
+// passed on to the motor's GoTo, with the planned acceleration and deceleration added to it, any
+// "velocity" override removed so that the planned speed is used, and with "strict_limits" set so that an st motor refuses the move rather than bounding the planned
+// speed or acceleration, which would make it arrive at a different time than the others.
+type Axis struct {
+	Name         string
+	Motor        motor.Motor
+	Rpm          float64
+	Acceleration float64
+	Deceleration float64
+	Extra        map[string]interface{}
+}
+
+// profile is how a single axis should move so that it finishes at the same time as the others.
+type profile struct {
+	target       float64
+	rpm          float64
+	acceleration float64
+	deceleration float64
+}
+
+// plan returns a profile for each axis so that they all take the same amount of time to travel
+// their distances, along with that time in seconds. Each axis would take some time on its own; we
+// find the slowest one, and then stretch every other axis's move out to match it. Stretching a
+// move out in time by a factor of k divides its velocity by k and its accelerations by k^2, so
+// the shape of every profile is preserved and no axis goes faster than it was asked to.
+func plan(axes []Axis, starts, targets []float64) ([]profile, float64) {
+	durations := make([]float64, len(axes))
+	var duration float64
+	for i, axis := range axes {
+		durations[i] = common.TrapezoidDuration(
+			targets[i]-starts[i], axis.Rpm/60, axis.Acceleration, axis.Deceleration)
+		duration = math.Max(duration, durations[i])
+	}
+
+	profiles := make([]profile, len(axes))
+	for i, axis := range axes {
+		profiles[i].target = targets[i]
+		if durations[i] == 0 {
+			continue // This axis isn't going anywhere.
+		}
+		scale := durations[i] / duration
+		profiles[i].rpm = axis.Rpm * scale
+		profiles[i].acceleration = axis.Acceleration * scale * scale
+		profiles[i].deceleration = axis.Deceleration * scale * scale
+	}
+	return profiles, duration
+}
+
+// Move moves every axis to its target so that they all arrive at the same time, and returns how
+// long the move was planned to take in seconds. The moves are all started together. If one of
+// them fails, the others are canceled rather than left to arrive on their own, and Move waits for
+// every one of them to finish before returning all of their errors combined.
+func Move(ctx context.Context, axes []Axis, targets []float64) (float64, error) {
+	if len(targets) != len(axes) {
+		return 0, fmt.Errorf("need %d targets, got %d", len(axes), len(targets))
+	}
+
+	starts := make([]float64, len(axes))
+	for i, axis := range axes {
+		position, err := axis.Motor.Position(ctx, nil)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", axis.Name, err)
+		}
+		starts[i] = position
+	}
+	profiles, duration := plan(axes, starts, targets)
+	if math.IsInf(duration, 1) {
+		return 0, fmt.Errorf("cannot plan a move with an axis that has no speed")
+	}
+
+	// Get every goroutine ready to go before starting any of them, so the moves begin as close
+	// together as we can manage.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make([]error, len(axes))
+	for i, axis := range axes {
+		if profiles[i].rpm == 0 {
+			continue
+		}
+		extra := map[string]interface{}{}
+		for key, value := range axis.Extra {
+			extra[key] = value
+		}
+		delete(extra, "velocity")
+		if profiles[i].acceleration > 0 {
+			extra["acceleration"] = profiles[i].acceleration
+		}
+		if profiles[i].deceleration > 0 {
+			extra["deceleration"] = profiles[i].deceleration
+		}
+		extra["strict_limits"] = true
+		wg.Add(1)
+		go func(i int, axis Axis, extra map[string]interface{}) {
+			defer wg.Done()
+			<-start
+			if err := axis.Motor.GoTo(ctx, profiles[i].rpm, profiles[i].target, extra); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", axis.Name, err)
+				cancel()
+			}
+		}(i, axis, extra)
+	}
+	close(start)
+	wg.Wait()
+	return duration, multierr.Combine(errs...)
+}
@@ -0,0 +1,74 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/components/motor"
+
+	"viam/viam-appliedmotion/common"
+)
+
+func TestPlanArrivesTogether(t *testing.T) {
+	axes := []Axis{
+		{Name: "long", Rpm: 600, Acceleration: 100, Deceleration: 50},
+		{Name: "short", Rpm: 600, Acceleration: 100, Deceleration: 100},
+		{Name: "slow", Rpm: 60, Acceleration: 10, Deceleration: 10},
+		{Name: "still", Rpm: 600, Acceleration: 100, Deceleration: 100},
+	}
+	starts := []float64{0, 5, 0, 3}
+	targets := []float64{20, 4, 2, 3}
+
+	profiles, duration := plan(axes, starts, targets)
+	for i, p := range profiles {
+		assert.Equal(t, targets[i], p.target)
+		if starts[i] == targets[i] {
+			assert.Equal(t, 0.0, p.rpm, axes[i].Name)
+			continue
+		}
+		// No axis should be asked to go faster than it would on its own.
+		assert.LessOrEqual(t, p.rpm, axes[i].Rpm, axes[i].Name)
+		assert.InDelta(t, duration, common.TrapezoidDuration(
+			targets[i]-starts[i], p.rpm/60, p.acceleration, p.deceleration), 1e-9, axes[i].Name)
+	}
+}
+
+// fakeMotor is a motor at 0 that moves by calling goTo.
+type fakeMotor struct {
+	motor.Motor
+	goTo func(ctx context.Context, extra map[string]interface{}) error
+}
+
+func (m *fakeMotor) Position(ctx context.Context, extra map[string]interface{}) (float64, error) {
+	return 0, nil
+}
+
+func (m *fakeMotor) GoTo(ctx context.Context, rpm, position float64, extra map[string]interface{}) error {
+	return m.goTo(ctx, extra)
+}
+
+func TestMoveCancelsOnError(t *testing.T) {
+	failing := &fakeMotor{goTo: func(ctx context.Context, extra map[string]interface{}) error {
+		return errors.New("fault")
+	}}
+	var got map[string]interface{}
+	waiting := &fakeMotor{goTo: func(ctx context.Context, extra map[string]interface{}) error {
+		got = extra
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	axes := []Axis{
+		{Name: "failing", Motor: failing, Rpm: 60},
+		{Name: "waiting", Motor: waiting, Rpm: 60, Acceleration: 10, Extra: map[string]interface{}{"run_current": 1.0, "velocity": 1.0}},
+	}
+	_, err := Move(context.Background(), axes, []float64{1, 1})
+	assert.ErrorContains(t, err, "failing: fault")
+	assert.ErrorIs(t, err, context.Canceled, "the other axis should have been canceled")
+	assert.Equal(t, map[string]interface{}{
+		"run_current": 1.0, "acceleration": 10.0, "strict_limits": true,
+	}, got, "the planned speed should replace any velocity override")
+	assert.Equal(t, map[string]interface{}{"run_current": 1.0, "velocity": 1.0}, axes[1].Extra, "the caller's extra shouldn't change")
+}
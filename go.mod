@@ -3,6 +3,7 @@ module viam/viam-appliedmotion
 go 1.21.13
 
 require (
+	github.com/golang/geo v0.0.0-20210211234256-740aa86cb551
 	github.com/stretchr/testify v1.9.0
 	go.uber.org/multierr v1.11.0
 	go.viam.com/rdk v0.41.0
@@ -44,7 +45,6 @@ require (
 	github.com/goccy/go-json v0.10.2 // indirect
 	github.com/golang-jwt/jwt/v4 v4.5.0 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
-	github.com/golang/geo v0.0.0-20210211234256-740aa86cb551 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/golang/snappy v0.0.4 // indirect
@@ -3,12 +3,18 @@ package main
 import (
 	"context"
 
+	"go.viam.com/rdk/components/gantry"
 	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/components/sensor"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/module"
+	"go.viam.com/rdk/services/generic"
 	"go.viam.com/utils"
 
+	"viam/viam-appliedmotion/coordinator"
 	"viam/viam-appliedmotion/st"
+	"viam/viam-appliedmotion/stanalog"
+	"viam/viam-appliedmotion/stgantry"
 )
 
 func main() {
@@ -26,6 +32,21 @@ func mainWithArgs(ctx context.Context, args []string, logger logging.Logger) (er
 		return err
 	}
 
+	err = custom_module.AddModelFromRegistry(ctx, gantry.API, stgantry.Model)
+	if err != nil {
+		return err
+	}
+
+	err = custom_module.AddModelFromRegistry(ctx, generic.API, coordinator.Model)
+	if err != nil {
+		return err
+	}
+
+	err = custom_module.AddModelFromRegistry(ctx, sensor.API, stanalog.Model)
+	if err != nil {
+		return err
+	}
+
 	err = custom_module.Start(ctx)
 	defer custom_module.Close(ctx)
 	if err != nil {
@@ -0,0 +1,63 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// AnalogConfig describes how to turn the voltage on the drive's analog input into a value the
+// user cares about (e.g., the deflection of a joystick).
+type AnalogConfig struct {
+	// Which analog input to read. 0 means the drive's only (or default) analog input.
+	Input    int     `json:"input,omitempty"`
+	Scale    float64 `json:"scale,omitempty"`
+	Offset   float64 `json:"offset,omitempty"`
+	Deadband float64 `json:"deadband,omitempty"`
+}
+
+func (conf *AnalogConfig) Validate() error {
+	if conf.Input < 0 {
+		return errors.New("analog input must be >= 0")
+	}
+	if conf.Deadband < 0 {
+		return errors.New("analog deadband must be >= 0")
+	}
+	return nil
+}
+
+// scale converts a raw reading in volts to the user's units. The offset is subtracted first, and
+// any reading within the deadband of the offset is treated as exactly 0. Outside of the deadband,
+// the value is measured from its edge, so it starts again from 0 rather than jumping.
+func (conf *AnalogConfig) scale(raw float64) float64 {
+	value := raw - conf.Offset
+	if math.Abs(value) <= conf.Deadband {
+		return 0
+	}
+	value -= math.Copysign(conf.Deadband, value)
+	scale := conf.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	return value * scale
+}
+
+// readAnalog returns both the raw voltage on the analog input and its scaled value.
+func (s *st) readAnalog(ctx context.Context) (float64, float64, error) {
+	command := "IA"
+	if s.analog.Input != 0 {
+		command = fmt.Sprintf("IA%d", s.analog.Input)
+	}
+	resp, err := s.comm.query(ctx, command)
+	if err != nil {
+		return 0, 0, err
+	}
+	raw, err := strconv.ParseFloat(strings.TrimSpace(resp), 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return raw, s.analog.scale(raw), nil
+}
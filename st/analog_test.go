@@ -0,0 +1,22 @@
+package st
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalogScale(t *testing.T) {
+	conf := AnalogConfig{Offset: 5, Deadband: 0.5, Scale: 2}
+	assert.Equal(t, 0.0, conf.scale(5))
+	assert.Equal(t, 0.0, conf.scale(5.5))
+	assert.Equal(t, 0.0, conf.scale(4.5))
+	// Past the deadband, the value starts from 0 rather than jumping to 1.
+	assert.InDelta(t, 0.2, conf.scale(5.6), 1e-9)
+	assert.InDelta(t, -0.2, conf.scale(4.4), 1e-9)
+	assert.Equal(t, 9.0, conf.scale(10))
+
+	// The scale defaults to 1.
+	conf = AnalogConfig{}
+	assert.Equal(t, -3.0, conf.scale(-3))
+}
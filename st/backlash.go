@@ -0,0 +1,115 @@
+package st
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// backlash keeps track of which side of the gear teeth the output is resting on. Moving the motor
+// in a new direction first takes up the slack in the gears without moving the output at all, so
+// the output's position is the motor's position plus an offset that depends on the last direction
+// of travel. We measure the offset from the positive side: after moving forward it's 0, and after
+// moving backward the output is amount steps ahead of the motor.
+type backlash struct {
+	amount int64 // in steps
+	// If nonzero, always finish moves traveling in this direction (1 or -1), so the output ends
+	// up resting on the same side of the gear teeth no matter where it came from.
+	approach int
+	// The last direction of travel. We don't know it until the first move, and assume forward.
+	direction int
+}
+
+func parseApproach(approach string) (int, error) {
+	switch strings.ToLower(approach) {
+	case "":
+		return 0, nil
+	case "positive":
+		return 1, nil
+	case "negative":
+		return -1, nil
+	default:
+		return 0, fmt.Errorf("backlash_approach must be positive or negative, got %#v", approach)
+	}
+}
+
+func (b *backlash) enabled() bool {
+	return b.amount != 0 || b.approach != 0
+}
+
+// offset returns how many steps the output is ahead of the motor.
+func (b *backlash) offset() int64 {
+	if b.direction < 0 {
+		return b.amount
+	}
+	return 0
+}
+
+// setDirection records a change of direction that we didn't compensate for (e.g., jogging), so
+// that the reported position is still right afterwards.
+func (b *backlash) setDirection(direction int) {
+	if direction != 0 {
+		b.direction = direction
+	}
+}
+
+// setDirection records a change of direction, like backlash.setDirection, and publishes the new
+// conversion. The caller must hold the mutex.
+func (s *st) setDirection(direction int) {
+	s.backlash.setDirection(direction)
+	s.updateConversion()
+}
+
+// segment returns how far the motor must move for the output to move outputSteps, and records
+// the new direction of travel.
+func (b *backlash) segment(outputSteps int64) int64 {
+	oldOffset := b.offset()
+	switch {
+	case outputSteps > 0:
+		b.direction = 1
+	case outputSteps < 0:
+		b.direction = -1
+	}
+	return outputSteps - b.offset() + oldOffset
+}
+
+// plan returns the relative motor moves (in steps) needed to move the output by outputSteps. If
+// an approach direction is configured and we're moving the other way, we overshoot the target by
+// the backlash and then come back to it, so the last move is always in the approach direction.
+// plan doesn't change the direction of travel; that's recorded as each move is made.
+func (b *backlash) plan(outputSteps int64) []int64 {
+	if outputSteps == 0 {
+		return nil
+	}
+	planned := *b
+	if b.approach != 0 && (outputSteps > 0) != (b.approach > 0) {
+		overshoot := int64(b.approach) * b.amount
+		return []int64{planned.segment(outputSteps - overshoot), planned.segment(overshoot)}
+	}
+	return []int64{planned.segment(outputSteps)}
+}
+
+// compensatedMove moves the output by (or, for FP, to) positionSteps, adding the extra motor
+// travel needed to take up the backlash. Every motor move is sent as a relative FL.
+func (s *st) compensatedMove(ctx context.Context, command string, positionSteps int64, revSec float64) error {
+	outputSteps := positionSteps
+	if command == "FP" {
+		current, err := s.readSteps(ctx)
+		if err != nil {
+			return err
+		}
+		outputSteps = positionSteps - (current + s.backlash.offset())
+	}
+	for _, motorSteps := range s.backlash.plan(outputSteps) {
+		if err := s.moveSteps(ctx, "FL", motorSteps, revSec); err != nil {
+			return err
+		}
+		// Only once the move is done are the gears resting on the other side.
+		if motorSteps > 0 {
+			s.setDirection(1)
+		} else {
+			s.setDirection(-1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package st
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// simulate returns where the output ends up after the motor makes the given moves, starting with
+// both at 0 and the gears resting on their positive side.
+func simulate(amount int64, motorMoves []int64) int64 {
+	var motor, output int64
+	slack := int64(0) // How far the motor can move backward before it pushes the output
+	for _, move := range motorMoves {
+		for ; move > 0; move-- {
+			motor++
+			if slack > 0 {
+				slack--
+			} else {
+				output++
+			}
+		}
+		for ; move < 0; move++ {
+			motor--
+			if slack < amount {
+				slack++
+			} else {
+				output--
+			}
+		}
+	}
+	return output
+}
+
+// move plans a move of the output by delta, and makes it.
+func move(b *backlash, delta int64) []int64 {
+	planned := b.plan(delta)
+	for _, m := range planned {
+		if m > 0 {
+			b.setDirection(1)
+		} else {
+			b.setDirection(-1)
+		}
+	}
+	return planned
+}
+
+func TestBacklashCompensation(t *testing.T) {
+	b := backlash{amount: 10}
+	var moves []int64
+	var expected int64
+	for _, delta := range []int64{100, -30, -20, 50, 5, -100} {
+		moves = append(moves, move(&b, delta)...)
+		expected += delta
+		assert.Equal(t, expected, simulate(10, moves), "after moving %d", delta)
+	}
+}
+
+func TestBacklashApproach(t *testing.T) {
+	b := backlash{amount: 10, approach: 1}
+	var moves []int64
+	var expected int64
+	for _, delta := range []int64{100, -30, 50, -5} {
+		planned := move(&b, delta)
+		moves = append(moves, planned...)
+		expected += delta
+		assert.Equal(t, expected, simulate(10, moves), "after moving %d", delta)
+		assert.Greater(t, planned[len(planned)-1], int64(0), "should approach from below")
+		assert.Equal(t, int64(0), b.offset())
+	}
+}
+
+func TestFailedMoveKeepsDirection(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, nil)
+	s.backlash.amount = 10
+	s.setDirection(1)
+
+	// Nothing can be sent, so the motor never moved, and the gears are still resting as they were.
+	assert.NotNil(t, s.compensatedMove(ctx, "FL", -100, 1))
+	assert.Equal(t, 1, s.backlash.direction)
+	assert.Equal(t, int64(0), s.conversion().backlashOffset)
+	assert.Nil(t, s.comm.Close())
+}
@@ -0,0 +1,176 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/utils"
+)
+
+var outputPattern = regexp.MustCompile(`^Y[0-9]+$`)
+
+// BrakeConfig describes a holding brake wired to one of the drive's outputs.
+type BrakeConfig struct {
+	Output string `json:"output"`
+
+	// By default the brake is released by closing the output (SO..L), which energizes the brake
+	// coil. Set this if the output needs to be open (SO..H) to release the brake instead.
+	ReleaseHigh bool `json:"release_high,omitempty"`
+
+	// How long the brake takes to let go after it is released, and to grab after it is engaged.
+	ReleaseDelayMs int `json:"release_delay_ms,omitempty"`
+	EngageDelayMs  int `json:"engage_delay_ms,omitempty"`
+}
+
+func (conf *BrakeConfig) Validate() error {
+	if !outputPattern.MatchString(conf.Output) {
+		return fmt.Errorf("brake output must be a drive output like Y2, got %#v", conf.Output)
+	}
+	if conf.ReleaseDelayMs < 0 || conf.EngageDelayMs < 0 {
+		return errors.New("brake delays must be >= 0")
+	}
+	return nil
+}
+
+// brake keeps track of the brake output. The brake should only ever be released while the motor
+// is enabled, so that the motor is holding the load whenever the brake isn't.
+type brake struct {
+	conf     BrakeConfig
+	mu       sync.Mutex
+	released bool
+}
+
+// set drives the brake output, and then waits for the brake to finish moving. The caller must hold
+// the brake's mutex.
+func (b *brake) set(ctx context.Context, comm commPort, release bool) error {
+	level, delay := "H", b.conf.EngageDelayMs
+	if release != b.conf.ReleaseHigh {
+		level = "L"
+	}
+	if release {
+		delay = b.conf.ReleaseDelayMs
+	}
+	if err := comm.set(ctx, "SO", b.conf.Output[1:]+level); err != nil {
+		return fmt.Errorf("unable to set brake output %s: %w", b.conf.Output, err)
+	}
+	b.released = release
+	if !utils.SelectContextOrWait(ctx, time.Duration(delay)*time.Millisecond) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// releaseBrake releases the brake before motion, if it isn't already. It refuses to if the motor
+// is disabled, since nothing would be holding the load.
+func (s *st) releaseBrake(ctx context.Context) error {
+	if s.brake == nil {
+		return nil
+	}
+	s.brake.mu.Lock()
+	defer s.brake.mu.Unlock()
+	if s.brake.released {
+		return nil
+	}
+	status, err := s.getStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if status[1]&1 == 0 {
+		return errors.New("refusing to release the brake while the motor is disabled, enable it first")
+	}
+	return s.brake.set(ctx, s.comm, true)
+}
+
+// engage engages the brake, e.g. before disabling the motor. It takes the comm to use, so that code
+// without the motor's mutex can pass in what shared() returned. A nil brake does nothing.
+func (b *brake) engage(ctx context.Context, comm commPort) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.set(ctx, comm, false)
+}
+
+// engageBrake engages the brake, e.g. before disabling the motor. The caller must hold the mutex.
+func (s *st) engageBrake(ctx context.Context) error {
+	return s.brake.engage(ctx, s.comm)
+}
+
+// engageIfDisabled engages the brake if the drive has disabled the motor on its own, e.g. because
+// of a fault. Like engage, it takes the comm to use.
+func (b *brake) engageIfDisabled(ctx context.Context, comm commPort, status []byte, logger logging.Logger) error {
+	if b == nil || len(status) != 2 || status[1]&1 == 1 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.released {
+		return nil
+	}
+	logger.Warn("The motor was disabled with the brake released, engaging the brake")
+	return b.set(ctx, comm, false)
+}
+
+// engageBrakeIfDisabled is engageIfDisabled with the motor's own brake and comm.
+func (s *st) engageBrakeIfDisabled(ctx context.Context, status []byte) error {
+	return s.brake.engageIfDisabled(ctx, s.comm, status, s.logger)
+}
+
+// syncBrake sets the brake to match the motor after connecting to the drive, since we don't know
+// what state the output was left in: released if the motor is enabled and holding, and engaged
+// otherwise.
+func (s *st) syncBrake(ctx context.Context) error {
+	if s.brake == nil {
+		return nil
+	}
+	status, err := s.getStatus(ctx)
+	if err != nil {
+		return err
+	}
+	s.brake.mu.Lock()
+	defer s.brake.mu.Unlock()
+	return s.brake.set(ctx, s.comm, status[1]&1 == 1)
+}
+
+// enable enables the motor, and then releases the brake.
+func (s *st) enable(ctx context.Context) error {
+	if err := s.comm.set(ctx, "ME", ""); err != nil {
+		return err
+	}
+	return s.releaseBrake(ctx)
+}
+
+// disable engages the brake, and then disables the motor.
+func (s *st) disable(ctx context.Context) error {
+	return disableWith(ctx, s.comm, s.brake)
+}
+
+// disableWith is disable for code that doesn't hold the mutex, with the comm and brake from
+// shared().
+func disableWith(ctx context.Context, comm commPort, b *brake) error {
+	if err := b.engage(ctx, comm); err != nil {
+		return err
+	}
+	return comm.set(ctx, "MD", "")
+}
+
+// brakeStatus describes the brake for DoCommands.
+func (s *st) brakeStatus() map[string]interface{} {
+	b := s.shared().brake
+	if b == nil {
+		return map[string]interface{}{"configured": false}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return map[string]interface{}{
+		"configured": true,
+		"output":     b.conf.Output,
+		"released":   b.released,
+	}
+}
@@ -0,0 +1,58 @@
+package st
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBrake(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		{"SC", "SC=0000"},
+		{"ME", "%"},
+		{"SC", "SC=0001"},
+		{"SO2L", "%"},
+		{"SO2H", "%"},
+		{"SO2H", "%"},
+		{"MD", "%"},
+	})
+	s.brake = &brake{conf: BrakeConfig{Output: "Y2"}}
+
+	// Nothing would hold the load, so the brake stays on.
+	assert.ErrorContains(t, s.releaseBrake(ctx), "while the motor is disabled")
+
+	assert.Nil(t, s.enable(ctx))
+	assert.True(t, s.brake.released)
+	assert.Nil(t, s.releaseBrake(ctx), "an already released brake shouldn't be released again")
+
+	// The drive disabling the motor on its own engages the brake.
+	assert.Nil(t, s.engageBrakeIfDisabled(ctx, []byte{0, 1}))
+	assert.Nil(t, s.engageBrakeIfDisabled(ctx, []byte{0, 4}))
+	assert.False(t, s.brake.released)
+
+	assert.Nil(t, s.disable(ctx))
+	assert.Nil(t, s.comm.Close())
+}
+
+func TestStopEngagesBrake(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		{"SK", "%"},
+		{"SC", "SC=0000"},
+		{"SO2H", "%"},
+	})
+	s.brake = &brake{conf: BrakeConfig{Output: "Y2"}, released: true}
+
+	// The drive had disabled the motor, so stopping engages the brake.
+	assert.Nil(t, s.Stop(ctx, nil))
+	assert.False(t, s.brake.released)
+	assert.Nil(t, s.comm.Close())
+}
+
+func TestBrakeConfig(t *testing.T) {
+	assert.Nil(t, (&BrakeConfig{Output: "Y3", ReleaseDelayMs: 100}).Validate())
+	assert.ErrorContains(t, (&BrakeConfig{Output: "X3"}).Validate(), "must be a drive output")
+	assert.ErrorContains(t, (&BrakeConfig{Output: "Y3", EngageDelayMs: -1}).Validate(), ">= 0")
+}
@@ -8,23 +8,33 @@ import (
 	"io/fs"
 	"net"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
+	"go.uber.org/multierr"
 	"go.viam.com/rdk/logging"
 )
 
+// ErrNotConnected is returned for commands sent while there is no connection to the drive, e.g.
+// after a Reconfigure that couldn't connect.
+var ErrNotConnected = errors.New("not connected to the drive")
+
 type commPort = *comms
 
 type comms struct {
-	mu     sync.RWMutex
-	logger logging.Logger
-	ctx    context.Context
-	uri    string
-	handle io.ReadWriteCloser
+	mu      sync.RWMutex
+	logger  logging.Logger
+	ctx     context.Context
+	uri     string
+	handle  io.ReadWriteCloser
+	metrics *metrics
+	trace   *tracer
 }
 
-func newIpComm(ctx context.Context, uri string, timeout time.Duration, logger logging.Logger) (commPort, error) {
+func newIpComm(
+	ctx context.Context, uri string, timeout time.Duration, m *metrics, logger logging.Logger,
+) (commPort, error) {
 	logger.Debugf("Dialing %s", uri)
 	d := net.Dialer{
 		Timeout:   timeout,
@@ -35,23 +45,49 @@ func newIpComm(ctx context.Context, uri string, timeout time.Duration, logger lo
 	if err != nil {
 		return nil, err
 	}
-	return &comms{handle: socket, uri: uri, logger: logger, mu: sync.RWMutex{}}, nil
+	return &comms{handle: socket, uri: uri, logger: logger, mu: sync.RWMutex{}, metrics: m}, nil
 }
 
-func newSerialComm(ctx context.Context, file string, logger logging.Logger) (commPort, error) {
+func newSerialComm(ctx context.Context, file string, m *metrics, logger logging.Logger) (commPort, error) {
 	logger.Debugf("Opening %s", file)
 	if fd, err := os.OpenFile(file, os.O_RDWR, fs.FileMode(os.O_RDWR)); err != nil {
 		return nil, err
 	} else {
-		return &comms{handle: fd, uri: file, logger: logger, mu: sync.RWMutex{}}, nil
+		return &comms{handle: fd, uri: file, logger: logger, mu: sync.RWMutex{}, metrics: m}, nil
+	}
+}
+
+// newReplayComm answers commands from a trace file recorded with trace_file, instead of talking
+// to a drive.
+func newReplayComm(file string, m *metrics, logger logging.Logger) (commPort, error) {
+	logger.Debugf("Replaying %s", file)
+	r, err := newReplay(file)
+	if err != nil {
+		return nil, err
 	}
+	return &comms{handle: r, uri: file, logger: logger, mu: sync.RWMutex{}, metrics: m}, nil
 }
 
 func (s *comms) send(ctx context.Context, command string) (string, error) {
+	if s == nil {
+		return "", ErrNotConnected
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.logger.Debugf("Sending command: %#v", command)
 
+	start := time.Now()
+	response, nWritten, nRead, err := s.exchange(command)
+	s.metrics.record(command, time.Since(start), nWritten, nRead, response, err)
+	if traceErr := s.trace.write(command, response, err); traceErr != nil {
+		s.logger.Warnf("Unable to write to trace file: %v", traceErr)
+	}
+	return response, err
+}
+
+// exchange writes a single command and reads its response. Along with the response, it returns
+// how many bytes were written and read. The caller must hold the mutex.
+func (s *comms) exchange(command string) (string, int, int, error) {
 	// As described on page 336 of
 	// https://appliedmotion.s3.amazonaws.com/Host-Command-Reference_920-0002W_0.pdf, all packets
 	// sent either from us or to us should start with the two bytes 0x00 0x07, and end with the
@@ -68,45 +104,68 @@ func (s *comms) send(ctx context.Context, command string) (string, error) {
 	s.logger.Debugf("Sending buffer: %#v", sendBuffer)
 	nWritten, err := s.handle.Write(sendBuffer)
 	if err != nil {
-		return "", err
+		return "", nWritten, 0, err
 	}
 	if nWritten != 3+len(command) {
-		return "", errors.New("failed to write all bytes")
+		return "", nWritten, 0, errors.New("failed to write all bytes")
 	}
 	readBuffer := make([]byte, 1024)
 	nRead, err := s.handle.Read(readBuffer)
 	if err != nil {
-		return "", err
+		return "", nWritten, nRead, err
 	}
 
 	// Like the packet we sent, the one we receive should start with 0x00 0x07 and end with 0x0D.
 	// We care about the part in between these.
 	if readBuffer[0] != 0x00 || readBuffer[1] != 0x07 || readBuffer[nRead-1] != 0x0D {
-		return "", fmt.Errorf("unexpected response from motor controller: %#v", readBuffer)
+		return "", nWritten, nRead, fmt.Errorf("unexpected response from motor controller: %#v", readBuffer)
 	}
 
-	retString := string(readBuffer[2:nRead-1])
+	retString := string(readBuffer[2 : nRead-1])
 	s.logger.Debugf("Response: %#v", retString)
 
-	return retString, nil
+	return retString, nWritten, nRead, nil
 }
 
 func (s *comms) store(ctx context.Context, command string, value float64) error {
 	// Many commands can only handle 3 digits of precision, but some can handle 4 and the
 	// controller will round to the nearest value it can handle anyway.
-	result, err := s.send(ctx, fmt.Sprintf("%s%.4f", command, value))
+	return s.set(ctx, command, fmt.Sprintf("%.4f", value))
+}
+
+// set sends the command with the given (already formatted) argument, and returns an error if the
+// controller does not acknowledge it.
+func (s *comms) set(ctx context.Context, command string, value string) error {
+	result, err := s.send(ctx, command+value)
 	if err != nil {
 		return err
 	}
 	// Executed commands use "%" for their ACK, and buffered commands use "*" for it.
 	if result != "%" && result != "*" {
-		return fmt.Errorf("got non-ack response when trying to set %s to %f: %s",
-		                  command, value, result)
+		return fmt.Errorf("got non-ack response when trying to set %s to %s: %s",
+			command, value, result)
 	}
 	return nil
 }
 
+// query sends a command with no arguments, and returns the value from the response. Responses
+// look something like "AC=100.000", and we return just the part after the "=".
+func (s *comms) query(ctx context.Context, command string) (string, error) {
+	response, err := s.send(ctx, command)
+	if err != nil {
+		return "", err
+	}
+	startIndex := strings.Index(response, "=")
+	if startIndex == -1 {
+		return "", fmt.Errorf("unexpected response to %s: %#v", command, response)
+	}
+	return response[startIndex+1:], nil
+}
+
 func (s *comms) Close() error {
+	if s == nil {
+		return nil
+	}
 	s.logger.Debugf("Closing %s", s.uri)
-	return s.handle.Close()
+	return multierr.Combine(s.handle.Close(), s.trace.close())
 }
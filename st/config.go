@@ -3,6 +3,7 @@ package st
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"go.uber.org/multierr"
 )
@@ -12,9 +13,25 @@ type Config struct {
 	Uri            string `json:"uri"`
 	ConnectTimeout int64  `json:"connect_timeout,omitempty"`
 
+	// Optional: the drive's model, such as STF10-IP, to check features against what it supports
+	DriveModel string `json:"drive_model,omitempty"`
+
+	// Optional: write every command and response to this file, for replaying later
+	TraceFile string `json:"trace_file,omitempty"`
+
 	StepsPerRev int64   `json:"steps_per_rev"`
 	MaxRpm      float64 `json:"max_rpm"`
 
+	// Optional user units: the motor turns gear_ratio times per output revolution, and the output
+	// moves units_per_rev units (e.g. mm) per revolution.
+	GearRatio   float64 `json:"gear_ratio,omitempty"`
+	UnitsPerRev float64 `json:"units_per_rev,omitempty"`
+	Units       string  `json:"units,omitempty"`
+
+	// Optional backlash compensation, in user units, and the direction to always finish moves in
+	Backlash         float64 `json:"backlash,omitempty"`
+	BacklashApproach string  `json:"backlash_approach,omitempty"`
+
 	// Optional motion control values
 	MinRpm              float64 `json:"min_rpm,omitempty"`
 	DefaultAcceleration float64 `json:"default_accel_revs_per_sec_squared,omitempty"`
@@ -23,6 +40,86 @@ type Config struct {
 	MaxAcceleration     float64 `json:"max_accel_revs_per_sec_squared,omitempty"`
 	MinDeceleration     float64 `json:"min_decel_revs_per_sec_squared,omitempty"`
 	MaxDeceleration     float64 `json:"max_decel_revs_per_sec_squared,omitempty"`
+
+	// Optional: how often to read the drive's status in the background, for data capture
+	StatusPollInterval int64 `json:"status_poll_interval_ms,omitempty"`
+
+	// Optional: serve Prometheus metrics about the drive link on this port
+	MetricsPort int `json:"metrics_port,omitempty"`
+	// Optional: the address to serve metrics on, which is only this machine (127.0.0.1) by default
+	MetricsHost string `json:"metrics_host,omitempty"`
+
+	// Optional: give up on a move after this many times its expected duration (default 2)
+	MoveTimeoutFactor float64 `json:"move_timeout_factor,omitempty"`
+
+	// Optional S-curve smoothing: the frequency of the drive's jerk filter (KJ). Lower is smoother.
+	JerkFilter float64 `json:"jerk_filter_hz,omitempty"`
+
+	// Optional homing: the SH condition to wait for (e.g. "X6L"), and the speed/direction to use
+	HomeInput string  `json:"home_input,omitempty"`
+	HomeRpm   float64 `json:"home_rpm,omitempty"`
+
+	// Optional electronic gearing: another motor to keep at follower_ratio times our position.
+	// Positions are in each motor's own units, so the ratio is follower units per unit of ours, and
+	// the drift is in the follower's units.
+	Follower         string  `json:"follower,omitempty"`
+	FollowerRatio    float64 `json:"follower_ratio,omitempty"`
+	MaxFollowerDrift float64 `json:"max_follower_drift,omitempty"`
+
+	// Optional: any other SCL parameters to set on the drive, such as {"CC": 2.5}
+	DriveParameters map[string]interface{} `json:"drive_parameters,omitempty"`
+
+	// Optional: an emergency stop input
+	EStop *EStopConfig `json:"estop,omitempty"`
+
+	// Optional: a file to keep the last known position in, to catch the drive losing it
+	PositionFile string `json:"position_file,omitempty"`
+
+	// Optional: a holding brake on one of the drive's outputs
+	Brake *BrakeConfig `json:"brake,omitempty"`
+
+	// Optional analog input, e.g. for a joystick used in analog velocity mode
+	AnalogInput *AnalogConfig `json:"analog_input,omitempty"`
+}
+
+// connectionSettings are the parts of the config that need a new connection to the drive when
+// they change.
+type connectionSettings struct {
+	protocol       string
+	uri            string
+	connectTimeout int64
+	traceFile      string
+}
+
+func (conf *Config) connectionSettings() connectionSettings {
+	return connectionSettings{
+		protocol:       strings.ToLower(conf.Protocol),
+		uri:            conf.Uri,
+		connectTimeout: conf.ConnectTimeout,
+		traceFile:      conf.TraceFile,
+	}
+}
+
+// moveSettings are the parts of the config that a move or jog in progress depends on, so that
+// changing them stops it: the connection it's running on, the conversion from user units to
+// steps, and the control mode set in drive_parameters.
+type moveSettings struct {
+	connection  connectionSettings
+	stepsPerRev int64
+	units       userUnits
+	controlMode string
+}
+
+func (conf *Config) moveSettings() moveSettings {
+	settings := moveSettings{
+		connection:  conf.connectionSettings(),
+		stepsPerRev: conf.StepsPerRev,
+		units:       newUserUnits(conf),
+	}
+	if mode, ok := conf.DriveParameters["CM"]; ok {
+		settings.controlMode = fmt.Sprint(mode)
+	}
+	return settings
 }
 
 // Validate ensures all parts of the config are valid.
@@ -33,6 +130,9 @@ func (conf *Config) Validate(path string) ([]string, error) {
 	if conf.Uri == "" {
 		return nil, errors.New("URI is required")
 	}
+	if conf.TraceFile != "" && strings.EqualFold(conf.Protocol, "replay") && conf.TraceFile == conf.Uri {
+		return nil, errors.New("trace_file can't be the trace being replayed")
+	}
 	if conf.StepsPerRev <= 0 {
 		return nil, errors.New("steps_per_rev must be > 0")
 	}
@@ -50,6 +150,94 @@ func (conf *Config) Validate(path string) ([]string, error) {
 		return nil, errors.New("max_rpm must be >= min_rpm")
 	}
 
+	if conf.GearRatio < 0 {
+		return nil, errors.New("gear_ratio must be > 0")
+	}
+	if conf.UnitsPerRev < 0 {
+		return nil, errors.New("units_per_rev must be > 0")
+	}
+
+	if conf.StatusPollInterval < 0 {
+		return nil, errors.New("status_poll_interval_ms must be >= 0")
+	}
+
+	if conf.MetricsPort < 0 || conf.MetricsPort > 65535 {
+		return nil, errors.New("metrics_port must be between 1 and 65535, or unset to not serve metrics")
+	}
+	if conf.MetricsHost != "" && conf.MetricsPort == 0 {
+		return nil, errors.New("metrics_host needs metrics_port to be set")
+	}
+
+	if conf.MoveTimeoutFactor != 0 && conf.MoveTimeoutFactor < 1 {
+		return nil, errors.New("move_timeout_factor must be >= 1")
+	}
+
+	if conf.JerkFilter < 0 {
+		return nil, errors.New("jerk_filter_hz must be >= 0")
+	}
+
+	if conf.Backlash < 0 {
+		return nil, errors.New("backlash must be >= 0")
+	}
+	if approach, err := parseApproach(conf.BacklashApproach); err != nil {
+		return nil, err
+	} else if approach != 0 && conf.Backlash == 0 {
+		return nil, errors.New("backlash_approach requires a nonzero backlash")
+	}
+
+	if err := validateDriveParameters(conf); err != nil {
+		return nil, err
+	}
+
+	if conf.AnalogInput != nil {
+		if err := conf.AnalogInput.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateHomeInput(conf.HomeInput); err != nil {
+		return nil, err
+	}
+	if conf.HomeInput != "" {
+		if err := lookupDriveModel(conf.DriveModel).checkIO(conf.HomeInput[:len(conf.HomeInput)-1]); err != nil {
+			return nil, fmt.Errorf("home_input: %w", err)
+		}
+	}
+	if conf.HomeInput != "" && conf.HomeRpm == 0 {
+		return nil, errors.New("home_rpm must be nonzero when home_input is set")
+	}
+
+	var deps []string
+	if conf.EStop != nil {
+		if err := conf.EStop.Validate(); err != nil {
+			return nil, err
+		}
+		if err := lookupDriveModel(conf.DriveModel).checkIO(conf.EStop.Input); err != nil {
+			return nil, fmt.Errorf("estop: %w", err)
+		}
+		if conf.EStop.Board != "" {
+			deps = append(deps, conf.EStop.Board)
+		}
+	}
+
+	if conf.Brake != nil {
+		if err := conf.Brake.Validate(); err != nil {
+			return nil, err
+		}
+		if err := lookupDriveModel(conf.DriveModel).checkIO(conf.Brake.Output); err != nil {
+			return nil, fmt.Errorf("brake: %w", err)
+		}
+	}
+
+	if conf.Follower != "" {
+		deps = append(deps, conf.Follower)
+	} else if conf.FollowerRatio != 0 || conf.MaxFollowerDrift != 0 {
+		return nil, errors.New("follower_ratio and max_follower_drift require a follower")
+	}
+	if conf.MaxFollowerDrift < 0 {
+		return nil, errors.New("max_follower_drift must be >= 0")
+	}
+
 	// Acceleration checks: start with a helper function
 	checkLessThan := func(a, b float64, accelPrefix, prefixA, prefixB string) error {
 		if a == 0 || b == 0 {
@@ -75,7 +263,7 @@ func (conf *Config) Validate(path string) ([]string, error) {
 		return nil
 	}
 
-	return nil, multierr.Combine(
+	return deps, multierr.Combine(
 		checkLessThan(conf.MinAcceleration, conf.MaxAcceleration, "ac", "min_", "max_"),
 		checkLessThan(conf.MinAcceleration, conf.DefaultAcceleration, "ac", "min_", ""),
 		checkLessThan(conf.DefaultAcceleration, conf.MaxAcceleration, "ac", "default_", "max_"),
@@ -0,0 +1,462 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// verb is a DoCommand, selected by the "command" key. The rest of the keys are its arguments.
+type verb struct {
+	help string
+	args []string
+	// Verbs that only read from the drive don't lock the st mutex, so they work while a move is
+	// in progress. Everything they touch must come through shared() or be guarded by its own
+	// mutex, since Reconfigure replaces the rest under the st mutex.
+	unlocked bool
+	run      func(s *st, ctx context.Context, args map[string]interface{}) (map[string]interface{}, error)
+}
+
+var verbs = map[string]verb{
+	"raw": {
+		help: "Send an SCL command, such as \"AC100\", and return the drive's response",
+		args: []string{"scl"},
+		run:  (*st).doRaw,
+	},
+	"status": {
+		help:     "Read the drive's status, position, temperature and alarms",
+		unlocked: true,
+		run:      (*st).doStatus,
+	},
+	"enable": {
+		help: "Enable the motor (ME)",
+		run:  (*st).doEnable,
+	},
+	"disable": {
+		help: "Disable the motor (MD), so it can be turned by hand",
+		run:  (*st).doDisable,
+	},
+	"home": {
+		help: "Move until the home_input sensor triggers, and set that position to 0",
+		run:  (*st).doHome,
+	},
+	"rearm": {
+		help: "Clear a latched e-stop for every motor in its group, once the e-stop is released",
+		run:  (*st).doRearm,
+	},
+	"acknowledge_position": {
+		help: "Clear the unhomed state without homing, optionally restoring the saved position",
+		args: []string{"restore"},
+		run:  (*st).doAcknowledgePosition,
+	},
+	"triggered_move": {
+		help: "Move like GoFor, setting outputs as the move passes positions along the way",
+		args: []string{"rpm", "position", "triggers", "poll_interval_ms"},
+		run:  (*st).doTriggeredMove,
+	},
+	"get_param": {
+		help: "Read a drive parameter, such as \"acceleration\" or \"AC\", in user units",
+		args: []string{"name"},
+		run:  (*st).doGetParam,
+	},
+	"set_param": {
+		help: "Set a drive parameter in user units, and check that the drive took the new value",
+		args: []string{"name", "value"},
+		run:  (*st).doSetParam,
+	},
+	"units": {
+		help: "Return the configured user units",
+		run:  (*st).doUnits,
+	},
+	"estimate_move": {
+		help: "Estimate how long a GoFor (or, with absolute, a GoTo) would take",
+		args: []string{"rpm", "position", "absolute"},
+		run:  (*st).doEstimateMove,
+	},
+	"follower_drift": {
+		help: "Return how far the follower is from its expected position",
+		run:  (*st).doFollowerDrift,
+	},
+	"read_analog": {
+		help: "Read the drive's analog input",
+		run:  (*st).doReadAnalog,
+	},
+	"set_mode": {
+		help: "Set the drive's control mode",
+		args: []string{"mode", "pulses_per_rev"},
+		run:  (*st).doSetMode,
+	},
+	"get_mode": {
+		help: "Read the drive's control mode",
+		run:  (*st).doGetMode,
+	},
+	"info": {
+		help: "Return the drive's model, firmware and capabilities",
+		run:  (*st).doInfo,
+	},
+	"backup_parameters": {
+		help: "Read the drive's settable parameters",
+		run:  (*st).doBackupParameters,
+	},
+	"restore_parameters": {
+		help: "Write back parameters from backup_parameters, optionally saving them with SA",
+		args: []string{"parameters", "save"},
+		run:  (*st).doRestoreParameters,
+	},
+	"readings": {
+		help:     "Return the latest background status reading",
+		unlocked: true,
+		run:      (*st).doReadings,
+	},
+	"metrics": {
+		help:     "Return counts and latencies of the commands sent to the drive",
+		unlocked: true,
+		run:      (*st).doMetrics,
+	},
+	"start_recording": {
+		help:     "Start sampling the drive into a ring buffer",
+		args:     []string{"rate_hz", "capacity"},
+		unlocked: true,
+		run:      (*st).doStartRecording,
+	},
+	"stop_recording": {
+		help:     "Stop sampling, keeping the samples",
+		unlocked: true,
+		run:      (*st).doStopRecording,
+	},
+	"get_recording": {
+		help:     "Return the recorded samples, as JSON or CSV",
+		args:     []string{"format"},
+		unlocked: true,
+		run:      (*st).doGetRecording,
+	},
+}
+
+// help describes every verb. It isn't in the verbs table itself, since it needs to read the
+// table.
+func help() map[string]interface{} {
+	result := map[string]interface{}{
+		"help": map[string]interface{}{"help": "List the available commands", "args": []interface{}{}},
+	}
+	for name, v := range verbs {
+		args := []interface{}{}
+		for _, arg := range v.args {
+			args = append(args, arg)
+		}
+		result[name] = map[string]interface{}{"help": v.help, "args": args}
+	}
+	return map[string]interface{}{"commands": result}
+}
+
+func verbNames() []string {
+	names := []string{"help"}
+	for name := range verbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DoCommand runs the verb named in the "command" key, such as {"command": "home"}. Arguments go
+// alongside it, such as {"command": "raw", "scl": "AC100"}. {"command": "help"} lists the verbs.
+func (s *st) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	s.logger.Debugf("DoCommand called with %v", cmd)
+	name, ok := cmd["command"].(string)
+	if !ok {
+		return nil, fmt.Errorf("DoCommand needs a \"command\" string, one of %s",
+			strings.Join(verbNames(), ", "))
+	}
+	if name == "help" {
+		return help(), nil
+	}
+	v, ok := verbs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown command %#v. To send SCL to the drive, use "+
+			"{\"command\": \"raw\", \"scl\": %#v}. Available commands: %s",
+			name, name, strings.Join(verbNames(), ", "))
+	}
+
+	args := map[string]interface{}{}
+	for key, value := range cmd {
+		if key == "command" {
+			continue
+		}
+		known := false
+		for _, arg := range v.args {
+			known = known || arg == key
+		}
+		if !known {
+			return nil, fmt.Errorf("%s doesn't take a %#v argument (it takes %v)", name, key, v.args)
+		}
+		args[key] = value
+	}
+
+	if !v.unlocked {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	return v.run(s, ctx, args)
+}
+
+// stringArg returns a string argument, or "" if it isn't required and isn't there.
+func stringArg(args map[string]interface{}, key string, required bool) (string, error) {
+	val, ok := args[key]
+	if !ok {
+		if required {
+			return "", fmt.Errorf("%s is required", key)
+		}
+		return "", nil
+	}
+	str, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string, got %#v", key, val)
+	}
+	return str, nil
+}
+
+// motionCommands are the SCL commands that can move the motor, or let something else move it, so
+// raw refuses them while the e-stop is latched or the axis is unhomed.
+var motionCommands = map[string]bool{
+	"CJ": true, // Start jogging
+	"CM": true, // Control mode, e.g. handing motion over to the analog input
+	"CS": true, // Change jogging speed
+	"FC": true, "FD": true, "FE": true, "FL": true, "FM": true, "FO": true, "FP": true, "FS": true, "FY": true,
+	"ME": true, // Enable
+	"QX": true, // Run a Q program
+	"SH": true, // Seek home
+}
+
+func (s *st) doRaw(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	command, err := stringArg(args, "scl", true)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.drive.caps.checkCommand(command); err != nil {
+		return nil, err
+	}
+	if len(command) >= 2 && motionCommands[strings.ToUpper(command[:2])] {
+		if err := s.checkEStop(); err != nil {
+			return nil, err
+		}
+		if err := s.checkHomed(); err != nil {
+			return nil, err
+		}
+	}
+	response, err := s.comm.send(ctx, command)
+	return map[string]interface{}{"response": response}, err
+}
+
+func (s *st) doStatus(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	snap, err := s.readSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"enabled":       snap.status[1]&1 == 1,
+		"fault":         snap.status[1]&4 != 0,
+		"in_position":   snap.status[1]&8 != 0,
+		"moving":        snap.status[1]&16 != 0,
+		"status":        float64(uint16(snap.status[0])<<8 | uint16(snap.status[1])),
+		"alarm_code":    float64(snap.alarm),
+		"temperature_c": snap.temperature,
+		"position":      snap.position,
+		"estop":         s.estopStatus(),
+		"brake":         s.brakeStatus(),
+		"position_file": s.positionFileStatus(),
+	}, nil
+}
+
+func (s *st) doEnable(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	if err := s.checkEStop(); err != nil {
+		return nil, err
+	}
+	if err := s.enable(ctx); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"enabled": true}, nil
+}
+
+func (s *st) doDisable(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	if err := s.disable(ctx); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"enabled": false}, nil
+}
+
+func (s *st) doRearm(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	if s.estop == nil {
+		return nil, errors.New("no estop is configured")
+	}
+	if err := s.estop.group.rearm(); err != nil {
+		return nil, err
+	}
+	return s.estopStatus(), nil
+}
+
+func (s *st) doHome(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	ctx, done := s.startMove(ctx)
+	defer done()
+	if err := s.home(ctx); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"homed": true}, nil
+}
+
+func (s *st) doAcknowledgePosition(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	restore, _ := args["restore"].(bool)
+	return s.acknowledgePosition(ctx, restore)
+}
+
+func (s *st) doTriggeredMove(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	rpm, err := extraFloat(args, "rpm")
+	if err != nil {
+		return nil, err
+	}
+	position, err := extraFloat(args, "position")
+	if err != nil {
+		return nil, err
+	}
+	triggers, err := parseTriggers(args["triggers"])
+	if err != nil {
+		return nil, err
+	}
+	pollInterval := defaultTriggerPollInterval
+	if ms, err := extraFloat(args, "poll_interval_ms"); err != nil {
+		return nil, err
+	} else if ms < 0 {
+		return nil, errors.New("poll_interval_ms must be >= 0")
+	} else if ms > 0 {
+		pollInterval = time.Duration(ms * float64(time.Millisecond))
+	}
+	ctx, done := s.startMove(ctx)
+	defer done()
+	return s.triggeredMove(ctx, rpm, position, triggers, pollInterval)
+}
+
+func (s *st) doGetParam(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	name, err := stringArg(args, "name", true)
+	if err != nil {
+		return nil, err
+	}
+	return s.getParam(ctx, name)
+}
+
+func (s *st) doSetParam(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	name, err := stringArg(args, "name", true)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := args["value"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("value must be a number, got %#v", args["value"])
+	}
+	return s.setParam(ctx, name, value)
+}
+
+func (s *st) doUnits(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"units":         s.units.label,
+		"gear_ratio":    s.units.gearRatio,
+		"units_per_rev": s.units.unitsPerRev,
+	}, nil
+}
+
+func (s *st) doEstimateMove(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	duration, err := s.estimateFromCommand(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"duration_sec": duration.Seconds()}, nil
+}
+
+func (s *st) doFollowerDrift(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	if s.follower == nil {
+		return nil, errors.New("no follower is configured")
+	}
+	position, err := s.position(ctx)
+	if err != nil {
+		return nil, err
+	}
+	drift, err := s.follower.drift(ctx, position)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"follower": s.follower.name, "drift": drift}, nil
+}
+
+func (s *st) doReadAnalog(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	raw, value, err := s.readAnalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"raw": raw, "value": value}, nil
+}
+
+func (s *st) doSetMode(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	name, err := stringArg(args, "mode", true)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := parseControlMode(name)
+	if err != nil {
+		return nil, err
+	}
+	var pulsesPerRev int64
+	if val, ok := args["pulses_per_rev"]; ok {
+		valFloat, ok := val.(float64)
+		if !ok || valFloat != math.Trunc(valFloat) {
+			return nil, fmt.Errorf("pulses_per_rev must be an integer, got %#v", val)
+		}
+		pulsesPerRev = int64(valFloat)
+	}
+	if err := s.setControlMode(ctx, mode, pulsesPerRev); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"mode": mode.String()}, nil
+}
+
+func (s *st) doGetMode(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	// Ask the drive rather than trusting our cached value: someone might have sent a raw CM.
+	mode, err := s.readControlMode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mode = mode
+	response := map[string]interface{}{
+		"mode":               mode.String(),
+		"cm":                 int(mode),
+		"accepts_host_moves": mode.acceptsHostMoves(),
+	}
+	if mode.isPulseFollowing() {
+		gearing, err := s.readGearing(ctx)
+		if err != nil {
+			return nil, err
+		}
+		response["pulses_per_rev"] = gearing
+	}
+	return response, nil
+}
+
+func (s *st) doInfo(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	return s.drive.toMap(), nil
+}
+
+func (s *st) doBackupParameters(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	return s.backup(ctx), nil
+}
+
+func (s *st) doRestoreParameters(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	return s.restoreParameters(ctx, args)
+}
+
+func (s *st) doReadings(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	return s.readings()
+}
+
+func (s *st) doMetrics(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	return s.metrics.summary(), nil
+}
@@ -0,0 +1,71 @@
+package st
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoCommandDispatch(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{{"AC", "AC=25.000"}})
+	s.units = userUnits{gearRatio: 1, unitsPerRev: 5, label: "mm"}
+	s.updateConversion()
+
+	_, err := s.DoCommand(ctx, map[string]interface{}{"scl": "AC"})
+	assert.ErrorContains(t, err, "needs a \"command\" string")
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": 3.0})
+	assert.ErrorContains(t, err, "needs a \"command\" string")
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "AC100"})
+	assert.ErrorContains(t, err, "unknown command \"AC100\"")
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "raw", "command_string": "AC"})
+	assert.ErrorContains(t, err, "raw doesn't take a \"command_string\" argument")
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "raw"})
+	assert.EqualError(t, err, "scl is required")
+
+	resp, err := s.DoCommand(ctx, map[string]interface{}{"command": "help"})
+	assert.Nil(t, err)
+	assert.Contains(t, resp["commands"], "raw")
+	assert.Contains(t, resp["commands"], "help")
+
+	resp, err = s.DoCommand(ctx, map[string]interface{}{"command": "get_param", "name": "AC"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name": "acceleration", "scl": "AC", "value": 125.0, "units": "mm/sec^2", "immediate": false,
+	}, resp)
+
+	// 30000 mm/sec^2 is 6000 revolutions/sec^2, which is too fast for the drive.
+	_, err = s.DoCommand(ctx, map[string]interface{}{
+		"command": "set_param", "name": "acceleration", "value": 30000.0,
+	})
+	assert.ErrorIs(t, err, ErrParameterOutOfRange)
+	assert.ErrorContains(t, err, "must be between 0.835 and 27305.835 mm/sec^2, got 30000")
+	_, err = s.DoCommand(ctx, map[string]interface{}{
+		"command": "set_param", "name": "steps_per_rev", "value": 400.0,
+	})
+	assert.ErrorContains(t, err, "can't be set with set_param")
+	assert.Nil(t, s.comm.Close(), "nothing should have been sent for the refused values")
+}
+
+func TestUnlockedStatus(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		{"SC", "SC=0019"},
+		{"IP", "IP=00004E20"},
+		{"IT", "IT=0190"},
+		{"AL", "AL=0000"},
+	})
+	s.brake = &brake{conf: BrakeConfig{Output: "Y2"}, released: true}
+
+	// A move holds the mutex, and status still answers, through what shared() returns.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp, err := s.DoCommand(ctx, map[string]interface{}{"command": "status"})
+	assert.Nil(t, err)
+	assert.Equal(t, true, resp["moving"])
+	assert.Equal(t, 1.0, resp["position"])
+	assert.Equal(t, true, resp["brake"].(map[string]interface{})["released"])
+	assert.Equal(t, false, resp["position_file"].(map[string]interface{})["configured"])
+	assert.Nil(t, s.comm.Close())
+}
@@ -0,0 +1,190 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupportedByDrive is returned when a feature isn't available on the configured drive model.
+var ErrUnsupportedByDrive = errors.New("not supported by this drive")
+
+// driveCapabilities describes what a drive model can do, from the Applied Motion datasheets.
+type driveCapabilities struct {
+	supported  bool    // Whether this module works with the drive at all (see the README)
+	maxCurrent float64 // Amps
+	inputs     int     // X1 to Xn
+	outputs    int     // Y1 to Yn
+	encoder    bool
+	qPrograms  bool
+}
+
+// driveModels is the support matrix from the README. The -C (CANopen) and -EC (EtherCAT) variants
+// don't speak SCL over a link we support, and the -D (basic) variants can't store Q programs.
+var driveModels = map[string]driveCapabilities{
+	"STF06-R":  {supported: true, maxCurrent: 6, inputs: 8, outputs: 4, encoder: true, qPrograms: true},
+	"STF06-C":  {supported: false, maxCurrent: 6, inputs: 8, outputs: 4, encoder: true},
+	"STF06-D":  {supported: true, maxCurrent: 6, inputs: 8, outputs: 4, encoder: true},
+	"STF06-IP": {supported: true, maxCurrent: 6, inputs: 8, outputs: 4, encoder: true, qPrograms: true},
+	"STF06-EC": {supported: false, maxCurrent: 6, inputs: 8, outputs: 4, encoder: true},
+	"STF10-R":  {supported: true, maxCurrent: 10, inputs: 8, outputs: 4, encoder: true, qPrograms: true},
+	"STF10-C":  {supported: false, maxCurrent: 10, inputs: 8, outputs: 4, encoder: true},
+	"STF10-D":  {supported: true, maxCurrent: 10, inputs: 8, outputs: 4, encoder: true},
+	"STF10-IP": {supported: true, maxCurrent: 10, inputs: 8, outputs: 4, encoder: true, qPrograms: true},
+	"STF10-EC": {supported: false, maxCurrent: 10, inputs: 8, outputs: 4, encoder: true},
+}
+
+// driveModelCodes maps the model codes that MV reports to the models in driveModels that report
+// them. Only codes read from real drives belong here, so that a wrong guess never overrides
+// drive_model. Drives with other codes still work, but identify warns about them so that the code
+// gets reported and added.
+var driveModelCodes = map[string][]string{}
+
+// lookupDriveModel returns the capabilities of the model, or nil if the model isn't in the table.
+func lookupDriveModel(model string) *driveCapabilities {
+	if caps, ok := driveModels[strings.ToUpper(model)]; ok {
+		return &caps
+	}
+	return nil
+}
+
+// driveInfo is what we know about the drive we're connected to.
+type driveInfo struct {
+	model      string // From the config, or from the model code if that's enough to tell
+	configured string // drive_model from the config
+	firmware   string
+	modelCode  string
+	revision   string
+	caps       *driveCapabilities // nil if the model is unknown, in which case nothing is checked
+}
+
+// identify asks the drive for its firmware version and model code. MV responds with something
+// like "MV=107M053": a firmware version of 1.07M, and a model code of 053. Older firmware doesn't
+// support RV, so failures are only logged. If model is empty, we use the model code to work out
+// which drive it is, when the code belongs to a single model.
+func (s *st) identify(ctx context.Context, model string) driveInfo {
+	info := driveInfo{model: model, configured: model}
+	if version, err := s.comm.query(ctx, "MV"); err != nil {
+		s.logger.Warnf("Unable to read the drive's model and firmware version: %v", err)
+	} else if len(version) > 4 {
+		info.firmware = version[:1] + "." + version[1:4]
+		info.modelCode = version[4:]
+	} else {
+		info.firmware = version
+	}
+	if revision, err := s.comm.query(ctx, "RV"); err != nil {
+		s.logger.Debugf("Unable to read the drive's revision: %v", err)
+	} else {
+		info.revision = revision
+	}
+
+	codeModels := driveModelCodes[info.modelCode]
+	if info.modelCode != "" && len(codeModels) == 0 {
+		s.logger.Warnf("The drive reports model code %s, which this module doesn't know. Please report "+
+			"it along with the drive's model, so that it can be recognized", info.modelCode)
+	}
+	switch {
+	case model == "" && len(codeModels) == 1:
+		info.model = codeModels[0]
+		s.logger.Infof("Connected to a %s (model code %s) with firmware %s", info.model, info.modelCode,
+			info.firmware)
+	case model == "":
+		s.logger.Infof("Connected to drive with firmware %s, model code %s. Set drive_model to check "+
+			"features against the drive", info.firmware, info.modelCode)
+	case len(codeModels) > 0 && !containsModel(codeModels, model):
+		s.logger.Warnf("drive_model is %s, but the drive reports model code %s, which is a %s. Check "+
+			"drive_model, since features are checked against it", model, info.modelCode,
+			strings.Join(codeModels, " or "))
+	}
+	info.caps = lookupDriveModel(info.model)
+	switch {
+	case info.model == "":
+	case info.caps == nil:
+		s.logger.Warnf("Drive model %s is not in the support matrix, so it has not been tested with "+
+			"this module", info.model)
+	case !info.caps.supported:
+		s.logger.Warnf("Drive model %s is known not to work with this module", info.model)
+	}
+	return info
+}
+
+func containsModel(models []string, model string) bool {
+	for _, m := range models {
+		if strings.EqualFold(m, model) {
+			return true
+		}
+	}
+	return false
+}
+
+func (info driveInfo) toMap() map[string]interface{} {
+	result := map[string]interface{}{
+		"model":      info.model,
+		"firmware":   info.firmware,
+		"model_code": info.modelCode,
+		"revision":   info.revision,
+	}
+	if info.caps != nil {
+		result["capabilities"] = map[string]interface{}{
+			"supported":        info.caps.supported,
+			"max_current_amps": info.caps.maxCurrent,
+			"inputs":           float64(info.caps.inputs),
+			"outputs":          float64(info.caps.outputs),
+			"encoder":          info.caps.encoder,
+			"q_programs":       info.caps.qPrograms,
+		}
+	}
+	return result
+}
+
+// checkIO returns an error if the drive doesn't have the named input (like "X6") or output (like
+// "Y2"). Anything that isn't a numbered X or Y isn't checked.
+func (caps *driveCapabilities) checkIO(name string) error {
+	if caps == nil || len(name) < 2 {
+		return nil
+	}
+	n, err := strconv.Atoi(name[1:])
+	if err != nil {
+		return nil
+	}
+	switch name[0] {
+	case 'X':
+		if n < 1 || n > caps.inputs {
+			return fmt.Errorf("%w: input %s (the drive has X1 to X%d)", ErrUnsupportedByDrive, name, caps.inputs)
+		}
+	case 'Y':
+		if n < 1 || n > caps.outputs {
+			return fmt.Errorf("%w: output %s (the drive has Y1 to Y%d)", ErrUnsupportedByDrive, name, caps.outputs)
+		}
+	}
+	return nil
+}
+
+// checkCurrent returns an error if the current, in amps, is more than the drive can supply.
+func (caps *driveCapabilities) checkCurrent(amps float64) error {
+	if caps != nil && amps > caps.maxCurrent {
+		return fmt.Errorf("%w: %f amps (the maximum is %f)", ErrUnsupportedByDrive, amps, caps.maxCurrent)
+	}
+	return nil
+}
+
+// checkCommand returns an error if a raw SCL command uses something the drive doesn't have.
+func (caps *driveCapabilities) checkCommand(command string) error {
+	if caps == nil || len(command) < 2 {
+		return nil
+	}
+	name, argument := strings.ToUpper(command[:2]), command[2:]
+	switch {
+	case name[0] == 'Q' && !caps.qPrograms:
+		return fmt.Errorf("%w: Q programs (%s)", ErrUnsupportedByDrive, command)
+	case (name == "IE" || name == "ER" || name == "EF") && !caps.encoder:
+		return fmt.Errorf("%w: encoder (%s)", ErrUnsupportedByDrive, command)
+	case name == "CC" || name == "CI":
+		if amps, err := strconv.ParseFloat(argument, 64); err == nil {
+			return caps.checkCurrent(amps)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package st
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/logging"
+)
+
+func TestDriveChecks(t *testing.T) {
+	caps := lookupDriveModel("stf10-ip")
+	assert.NotNil(t, caps)
+
+	assert.Nil(t, caps.checkIO("X8"))
+	assert.Nil(t, caps.checkIO("Y4"))
+	assert.ErrorIs(t, caps.checkIO("X9"), ErrUnsupportedByDrive)
+	assert.ErrorIs(t, caps.checkIO("Y0"), ErrUnsupportedByDrive)
+	assert.Nil(t, caps.checkIO("AIN"), "only numbered inputs and outputs are checked")
+
+	assert.Nil(t, caps.checkCurrent(10))
+	assert.ErrorIs(t, caps.checkCurrent(10.5), ErrUnsupportedByDrive)
+
+	assert.Nil(t, caps.checkCommand("QX1"))
+	assert.Nil(t, caps.checkCommand("ie"))
+	assert.Nil(t, caps.checkCommand("CC5"))
+	assert.ErrorIs(t, caps.checkCommand("cc12"), ErrUnsupportedByDrive)
+
+	basic := lookupDriveModel("STF06-D")
+	assert.ErrorIs(t, basic.checkCommand("QX1"), ErrUnsupportedByDrive)
+	assert.ErrorIs(t, basic.checkCommand("CI7"), ErrUnsupportedByDrive)
+
+	// Without a known model, nothing is checked.
+	var unknown *driveCapabilities
+	assert.Nil(t, unknown.checkIO("X20"))
+	assert.Nil(t, unknown.checkCurrent(100))
+	assert.Nil(t, unknown.checkCommand("QX1"))
+}
+
+func TestIdentify(t *testing.T) {
+	ctx := context.Background()
+	driveModelCodes["999"] = []string{"STF06-IP"}
+	defer delete(driveModelCodes, "999")
+	s := replayMotor(t, [][2]string{
+		{"MV", "MV=107M999"},
+		{"RV", "RV=5"},
+		{"MV", "MV=107M999"},
+		{"RV", "RV=5"},
+		{"MV", "MV=107M053"},
+		{"RV", "RV=5"},
+	})
+
+	// Without drive_model, the model code is enough to tell which drive it is.
+	info := s.identify(ctx, "")
+	assert.Equal(t, "STF06-IP", info.model)
+	assert.Equal(t, "1.07M", info.firmware)
+	assert.Equal(t, "999", info.modelCode)
+	assert.Equal(t, 6.0, info.caps.maxCurrent)
+
+	// A drive_model that doesn't match is only warned about, and features are checked against it.
+	info = s.identify(ctx, "STF10-IP")
+	assert.Equal(t, "STF10-IP", info.model)
+	assert.Equal(t, 10.0, info.caps.maxCurrent)
+
+	// A code we don't know is warned about, so that it gets reported.
+	logger, logs := logging.NewObservedTestLogger(t)
+	s.logger = logger
+	info = s.identify(ctx, "")
+	assert.Equal(t, "", info.model)
+	assert.Nil(t, info.caps)
+	assert.Equal(t, 1, logs.FilterMessageSnippet("model code 053, which this module doesn't know").Len())
+	assert.Nil(t, s.comm.Close())
+}
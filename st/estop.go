@@ -0,0 +1,400 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/utils"
+)
+
+// ErrEStopped is returned for motion commands while the motor's e-stop group is latched.
+var ErrEStopped = errors.New("e-stop is latched, clear it and send the rearm command first")
+
+const (
+	defaultEStopPollInterval = 20 * time.Millisecond
+	defaultEStopReadErrors   = 5
+)
+
+var estopInputPattern = regexp.MustCompile(`^X[0-9]+$`)
+
+// EStopConfig names the input an emergency stop is wired to: either one of the drive's inputs, or
+// a pin on a Viam board.
+type EStopConfig struct {
+	Input string `json:"input,omitempty"`
+	Board string `json:"board,omitempty"`
+	Pin   string `json:"pin,omitempty"`
+
+	// By default the e-stop is asserted when the input is low, so that a broken wire stops the
+	// motors, too.
+	ActiveHigh bool `json:"active_high,omitempty"`
+
+	// Motors in the same group stop together when any of their e-stops assert.
+	Group string `json:"group,omitempty"`
+
+	// "stop" (the default) stops the motors at the AM deceleration. "disable" also disables them.
+	Action string `json:"action,omitempty"`
+
+	PollIntervalMs int `json:"poll_interval_ms,omitempty"`
+
+	// If the input can't be read this many times in a row, we can't tell whether the e-stop is
+	// pressed, so the group trips as if it were.
+	MaxReadErrors int `json:"max_read_errors,omitempty"`
+}
+
+func (conf *EStopConfig) Validate() error {
+	switch {
+	case conf.Input != "" && conf.Board != "":
+		return errors.New("estop needs either an input or a board and pin, not both")
+	case conf.Input != "":
+		if !estopInputPattern.MatchString(conf.Input) {
+			return fmt.Errorf("estop input must be a drive input like X3, got %#v", conf.Input)
+		}
+	case conf.Board != "":
+		if conf.Pin == "" {
+			return errors.New("estop pin is required with a board")
+		}
+	default:
+		return errors.New("estop needs either an input or a board and pin")
+	}
+	if conf.Action != "" && conf.Action != "stop" && conf.Action != "disable" {
+		return fmt.Errorf("estop action must be \"stop\" or \"disable\", got %#v", conf.Action)
+	}
+	if conf.PollIntervalMs < 0 {
+		return errors.New("estop poll_interval_ms must be >= 0")
+	}
+	if conf.MaxReadErrors < 0 {
+		return errors.New("estop max_read_errors must be >= 0")
+	}
+	return nil
+}
+
+// groupName returns the configured group, or a default: every motor watching the same board pin
+// shares a group, and a drive input only belongs to its own motor.
+func (conf *EStopConfig) groupName(motorName string) string {
+	switch {
+	case conf.Group != "":
+		return conf.Group
+	case conf.Board != "":
+		return conf.Board + ":" + conf.Pin
+	default:
+		return motorName + ":" + conf.Input
+	}
+}
+
+// estopGroup is a set of motors that all stop together. Once tripped, it stays latched until it
+// is rearmed, even if the e-stop is released.
+type estopGroup struct {
+	name      string
+	mu        sync.Mutex
+	members   map[*st]bool
+	latched   bool
+	reason    string
+	trippedAt time.Time
+}
+
+// The e-stop groups are shared by every st motor in the module.
+var estopGroups = struct {
+	mu     sync.Mutex
+	groups map[string]*estopGroup
+}{groups: map[string]*estopGroup{}}
+
+func joinEStopGroup(name string, s *st) *estopGroup {
+	estopGroups.mu.Lock()
+	defer estopGroups.mu.Unlock()
+	g, ok := estopGroups.groups[name]
+	if !ok {
+		g = &estopGroup{name: name, members: map[*st]bool{}}
+		estopGroups.groups[name] = g
+	}
+	g.mu.Lock()
+	g.members[s] = true
+	g.mu.Unlock()
+	return g
+}
+
+// leave removes the motor from the group. The group is forgotten once it has no members left.
+func (g *estopGroup) leave(s *st) {
+	estopGroups.mu.Lock()
+	defer estopGroups.mu.Unlock()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.members, s)
+	if len(g.members) == 0 {
+		delete(estopGroups.groups, g.name)
+	}
+}
+
+// trip latches the group and stops every motor in it.
+func (g *estopGroup) trip(reason string) {
+	g.mu.Lock()
+	if g.latched {
+		g.mu.Unlock()
+		return
+	}
+	g.latched = true
+	g.reason = reason
+	g.trippedAt = time.Now()
+	var members []*st
+	for m := range g.members {
+		members = append(members, m)
+	}
+	g.mu.Unlock()
+
+	for _, m := range members {
+		m.logger.Errorf("E-stop group %s tripped: %s", g.name, reason)
+		m.emergencyStop()
+	}
+}
+
+// rearm clears the latch, as long as none of the group's e-stops are still asserted.
+func (g *estopGroup) rearm() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for m := range g.members {
+		w := m.shared().estop
+		if w == nil {
+			continue
+		}
+		if w.isAsserted() {
+			return fmt.Errorf("the e-stop for %s is still asserted", m.Name().ShortName())
+		}
+		if err := w.readError(); err != nil {
+			return fmt.Errorf("the e-stop for %s can't be read: %w", m.Name().ShortName(), err)
+		}
+	}
+	g.latched = false
+	g.reason = ""
+	return nil
+}
+
+func (g *estopGroup) isLatched() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.latched
+}
+
+// estopWatcher polls a single e-stop input in the background.
+type estopWatcher struct {
+	conf     EStopConfig
+	group    *estopGroup
+	mu       sync.Mutex
+	asserted bool
+	lastErr  error
+	errors   int // Consecutive read errors
+	cancel   func()
+	finished chan struct{}
+}
+
+func (w *estopWatcher) isAsserted() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.asserted
+}
+
+// update records a reading of the input, and returns why the group should trip, if it should.
+// A single failed read could be a flaky link, but if the input can't be read several times in a
+// row, we have to assume the worst.
+func (w *estopWatcher) update(level bool, err error) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err == nil {
+		w.lastErr = nil
+		w.errors = 0
+		w.asserted = level == w.conf.ActiveHigh
+		if w.asserted {
+			return "e-stop asserted"
+		}
+		return ""
+	}
+	w.lastErr = err
+	w.errors++
+	maxErrors := w.conf.MaxReadErrors
+	if maxErrors == 0 {
+		maxErrors = defaultEStopReadErrors
+	}
+	if w.errors >= maxErrors {
+		return fmt.Sprintf("unable to read the e-stop %d times in a row (%v)", w.errors, err)
+	}
+	return ""
+}
+
+func (w *estopWatcher) readError() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastErr
+}
+
+func (w *estopWatcher) stop() {
+	w.cancel()
+	<-w.finished
+}
+
+// readDriveInput reads one of the drive's inputs. IS responds with one character per input,
+// such as "IS=00001111", with X1 on the right.
+func (s *st) readDriveInput(ctx context.Context, input string) (bool, error) {
+	n, err := strconv.Atoi(input[1:])
+	if err != nil {
+		return false, err
+	}
+	resp, err := s.shared().comm.query(ctx, "IS")
+	if err != nil {
+		return false, err
+	}
+	resp = strings.TrimSpace(resp)
+	if n < 1 || n > len(resp) {
+		return false, fmt.Errorf("input %s isn't in the IS response %#v", input, resp)
+	}
+	return resp[len(resp)-n] == '1', nil
+}
+
+// startEStop starts watching the configured e-stop, and joins its group. If the motor was already
+// in the same group, it stays in it, so that a reconfigure doesn't clear a latched e-stop. The old
+// watcher is only stopped once the new one is running, so if this fails, it keeps watching.
+func (s *st) startEStop(deps resource.Dependencies, conf *EStopConfig) error {
+	old := s.estop
+	if conf == nil {
+		s.setEStopWatcher(nil)
+		if old != nil {
+			old.stop()
+			old.group.leave(s)
+		}
+		return nil
+	}
+
+	read := func(ctx context.Context) (bool, error) {
+		return s.readDriveInput(ctx, conf.Input)
+	}
+	if conf.Board != "" {
+		b, err := board.FromDependencies(deps, conf.Board)
+		if err != nil {
+			return fmt.Errorf("unable to get e-stop board %s: %w", conf.Board, err)
+		}
+		pin, err := b.GPIOPinByName(conf.Pin)
+		if err != nil {
+			return fmt.Errorf("unable to get e-stop pin %s: %w", conf.Pin, err)
+		}
+		read = func(ctx context.Context) (bool, error) {
+			return pin.Get(ctx, nil)
+		}
+	}
+
+	group := joinEStopGroup(conf.groupName(s.Name().ShortName()), s)
+	if old != nil && old.group != group {
+		old.group.leave(s)
+	}
+
+	interval := defaultEStopPollInterval
+	if conf.PollIntervalMs > 0 {
+		interval = time.Duration(conf.PollIntervalMs) * time.Millisecond
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &estopWatcher{conf: *conf, group: group, cancel: cancel, finished: make(chan struct{})}
+	utils.PanicCapturingGo(func() {
+		defer close(w.finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		failing := false
+		for {
+			level, err := read(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && !failing {
+				s.logger.Errorf("Unable to read e-stop input: %v", err)
+			}
+			failing = err != nil
+			if reason := w.update(level, err); reason != "" {
+				group.trip(fmt.Sprintf("%s on %s", reason, s.Name().ShortName()))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+	s.setEStopWatcher(w)
+	if old != nil {
+		old.stop()
+	}
+	return nil
+}
+
+func (s *st) setEStopWatcher(w *estopWatcher) {
+	s.sharedMu.Lock()
+	defer s.sharedMu.Unlock()
+	s.estop = w
+}
+
+// stopEStop stops watching the e-stop, but stays in the group.
+func (s *st) stopEStop() {
+	if s.estop != nil {
+		s.estop.stop()
+	}
+}
+
+// emergencyStop stops the motor without waiting for the mutex, since a move in progress holds it.
+// It usually runs on another motor's watcher, so it only uses what shared() returns.
+func (s *st) emergencyStop() {
+	ctx := context.Background()
+	s.cancelMove()
+	shared := s.shared()
+	if _, err := shared.comm.send(ctx, "SK"); err != nil {
+		s.logger.Errorf("Unable to stop for the e-stop: %v", err)
+	}
+	if shared.estop != nil && shared.estop.conf.Action == "disable" {
+		if err := disableWith(ctx, shared.comm, shared.brake); err != nil {
+			s.logger.Errorf("Unable to disable for the e-stop: %v", err)
+		}
+	}
+	if shared.follower != nil {
+		if err := shared.follower.motor.Stop(ctx, nil); err != nil {
+			s.logger.Errorf("Unable to stop follower for the e-stop: %v", err)
+		}
+	}
+}
+
+// checkEStop returns ErrEStopped if the motor's e-stop group is latched.
+func (s *st) checkEStop() error {
+	if s.estop != nil && s.estop.group.isLatched() {
+		return ErrEStopped
+	}
+	return nil
+}
+
+// estopStatus describes the e-stop for DoCommands.
+func (s *st) estopStatus() map[string]interface{} {
+	w := s.shared().estop
+	if w == nil {
+		return map[string]interface{}{"configured": false}
+	}
+	w.mu.Lock()
+	result := map[string]interface{}{
+		"configured": true,
+		"asserted":   w.asserted,
+	}
+	if w.lastErr != nil {
+		result["error"] = w.lastErr.Error()
+	}
+	w.mu.Unlock()
+
+	g := w.group
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	result["group"] = g.name
+	result["latched"] = g.latched
+	if g.latched {
+		result["reason"] = g.reason
+		result["tripped_at"] = g.trippedAt.Format(time.RFC3339Nano)
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/resource"
+)
+
+func TestEStopGroup(t *testing.T) {
+	a := replayMotor(t, [][2]string{{"SK", "%"}, {"MD", "%"}, {"IP", "IP=00000000"}})
+	a.Named = resource.NewName(resource.APINamespaceRDK.WithComponentType("motor"), "a").AsNamed()
+	b := replayMotor(t, [][2]string{{"SK", "%"}})
+	b.Named = resource.NewName(resource.APINamespaceRDK.WithComponentType("motor"), "b").AsNamed()
+
+	group := joinEStopGroup("test", a)
+	assert.Equal(t, group, joinEStopGroup("test", b))
+	a.estop = &estopWatcher{conf: EStopConfig{Action: "disable"}, group: group}
+	b.estop = &estopWatcher{group: group}
+	assert.Nil(t, a.checkEStop())
+
+	// Tripping stops both motors, and only disables the one configured to.
+	b.estop.asserted = true
+	group.trip("pressed")
+	group.trip("pressed again")
+	assert.ErrorIs(t, a.checkEStop(), ErrEStopped)
+	assert.ErrorIs(t, b.checkEStop(), ErrEStopped)
+
+	// Raw motion commands are refused, but everything else still goes through.
+	for _, scl := range []string{"FL20000", "cj", "ME", "SH"} {
+		_, err := a.DoCommand(context.Background(), map[string]interface{}{"command": "raw", "scl": scl})
+		assert.ErrorIs(t, err, ErrEStopped)
+	}
+	_, err := a.DoCommand(context.Background(), map[string]interface{}{"command": "raw", "scl": "IP"})
+	assert.Nil(t, err)
+
+	assert.Nil(t, a.comm.Close(), "a should have been stopped and disabled")
+	assert.Nil(t, b.comm.Close(), "b should have been stopped once")
+
+	assert.ErrorContains(t, group.rearm(), "the e-stop for b is still asserted")
+	b.estop.asserted = false
+	assert.Nil(t, group.rearm())
+	assert.Nil(t, a.checkEStop())
+
+	group.leave(a)
+	group.leave(b)
+	assert.NotContains(t, estopGroups.groups, "test")
+}
+
+func TestEStopEngagesBrake(t *testing.T) {
+	s := replayMotor(t, [][2]string{{"SK", "%"}, {"SO2H", "%"}, {"MD", "%"}})
+	group := &estopGroup{members: map[*st]bool{s: true}}
+	s.estop = &estopWatcher{conf: EStopConfig{Action: "disable"}, group: group}
+	s.brake = &brake{conf: BrakeConfig{Output: "Y2"}, released: true}
+
+	// The brake is engaged before the motor is disabled, through the comm and brake that shared()
+	// returned.
+	group.trip("pressed")
+	assert.False(t, s.brake.released)
+	assert.Nil(t, s.comm.Close())
+}
+
+func TestEStopKeptWhenReconfigureFails(t *testing.T) {
+	s := replayMotor(t, nil)
+	stopped := false
+	old := &estopWatcher{
+		group:    &estopGroup{members: map[*st]bool{}},
+		cancel:   func() { stopped = true },
+		finished: make(chan struct{}),
+	}
+	s.estop = old
+
+	// The board isn't in the dependencies, so the new watcher can't start. The old one must keep
+	// watching rather than leaving the motor unprotected.
+	err := s.startEStop(resource.Dependencies{}, &EStopConfig{Board: "board", Pin: "37"})
+	assert.ErrorContains(t, err, "unable to get e-stop board")
+	assert.Equal(t, old, s.estop)
+	assert.False(t, stopped, "the old watcher should still be running")
+}
+
+func TestEStopReadErrors(t *testing.T) {
+	w := &estopWatcher{conf: EStopConfig{MaxReadErrors: 3}}
+	readErr := errors.New("i/o timeout")
+	assert.Equal(t, "", w.update(false, readErr))
+	assert.Equal(t, "", w.update(false, readErr))
+	// A good read starts the count over.
+	assert.Equal(t, "", w.update(true, nil))
+	assert.Equal(t, "", w.update(false, readErr))
+	assert.Equal(t, "", w.update(false, readErr))
+	assert.Equal(t, "unable to read the e-stop 3 times in a row (i/o timeout)", w.update(false, readErr))
+	assert.ErrorIs(t, w.readError(), readErr)
+
+	assert.Equal(t, "e-stop asserted", w.update(false, nil))
+	assert.Nil(t, w.readError())
+}
@@ -0,0 +1,125 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"go.uber.org/multierr"
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/resource"
+)
+
+// ErrFollowerDrift is returned when, after a move, the follower is further from its expected
+// position than the configured maximum drift.
+var ErrFollowerDrift = errors.New("follower drifted too far from the leader")
+
+// follower is another motor that we keep at a fixed ratio to this one, by mirroring every move we
+// make onto it. The follower's position should always be ratio times our position.
+type follower struct {
+	name     string
+	motor    motor.Motor
+	ratio    float64
+	maxDrift float64
+}
+
+func newFollower(deps resource.Dependencies, conf *Config) (*follower, error) {
+	if conf.Follower == "" {
+		return nil, nil
+	}
+	m, err := motor.FromDependencies(deps, conf.Follower)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get follower motor %s: %w", conf.Follower, err)
+	}
+	ratio := conf.FollowerRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	return &follower{
+		name:     conf.Follower,
+		motor:    m,
+		ratio:    ratio,
+		maxDrift: conf.MaxFollowerDrift,
+	}, nil
+}
+
+// scaleExtra returns a copy of the extra map with the accelerations and velocities scaled to match
+// the follower, so that both motors stay in ratio while speeding up and slowing down, too. Other
+// overrides, like currents, are passed on as they are.
+func (f *follower) scaleExtra(extra map[string]interface{}) map[string]interface{} {
+	scaled := make(map[string]interface{}, len(extra))
+	for key, value := range extra {
+		scaled[key] = value
+	}
+	for _, o := range moveOverrides {
+		p, _ := lookupParam(o.scl)
+		if p.units != unitsAcceleration && p.units != unitsVelocity {
+			continue
+		}
+		if value, ok := scaled[o.key].(float64); ok {
+			scaled[o.key] = value * math.Abs(f.ratio)
+		}
+	}
+	return scaled
+}
+
+// mirror runs the leader's move and the follower's move at the same time. If either of them
+// fails, the other one is canceled so that the two motors don't wander apart.
+func (f *follower) mirror(
+	ctx context.Context,
+	leaderMove func(context.Context) error,
+	followerMove func(context.Context) error,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var leaderErr, followerErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if followerErr = followerMove(ctx); followerErr != nil {
+			cancel()
+		}
+	}()
+	if leaderErr = leaderMove(ctx); leaderErr != nil {
+		cancel()
+	}
+	wg.Wait()
+
+	if followerErr != nil {
+		followerErr = fmt.Errorf("follower %s: %w", f.name, followerErr)
+	}
+	return multierr.Combine(leaderErr, followerErr)
+}
+
+// drift returns how far the follower is from where it should be, given the leader's position. The
+// leader's position is in its user units, and the drift is in the follower's.
+func (f *follower) drift(ctx context.Context, leaderPosition float64) (float64, error) {
+	followerPosition, err := f.motor.Position(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	return followerPosition - f.ratio*leaderPosition, nil
+}
+
+// checkDrift returns ErrFollowerDrift if the follower has drifted further than allowed. Drift is
+// always logged, so that it can be watched even if no maximum is configured.
+func (s *st) checkDrift(ctx context.Context) error {
+	leaderPosition, err := s.position(ctx)
+	if err != nil {
+		return err
+	}
+	drift, err := s.follower.drift(ctx, leaderPosition)
+	if err != nil {
+		return err
+	}
+	s.logger.Debugf("Follower %s drift: %f", s.follower.name, drift)
+	if s.follower.maxDrift > 0 && math.Abs(drift) > s.follower.maxDrift {
+		return fmt.Errorf("%w: %s is %f (in its own units) from its expected position (max %f)",
+			ErrFollowerDrift, s.follower.name, drift, s.follower.maxDrift)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/components/motor"
+)
+
+// fakeFollower is a follower motor that records the moves it's given, and moves by calling goFor.
+type fakeFollower struct {
+	motor.Motor
+	goFor    func(ctx context.Context) error
+	rpm      float64
+	revs     float64
+	extra    map[string]interface{}
+	position float64
+	stopped  bool
+}
+
+func (m *fakeFollower) GoFor(ctx context.Context, rpm, revs float64, extra map[string]interface{}) error {
+	m.rpm, m.revs, m.extra = rpm, revs, extra
+	if m.goFor == nil {
+		m.position += revs
+		return nil
+	}
+	return m.goFor(ctx)
+}
+
+func (m *fakeFollower) Stop(ctx context.Context, extra map[string]interface{}) error {
+	m.stopped = true
+	return nil
+}
+
+func (m *fakeFollower) Position(ctx context.Context, extra map[string]interface{}) (float64, error) {
+	return m.position, nil
+}
+
+func TestFollowerMirrorsMove(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		{"SK", "%"},
+		{"AC", "AC=25.000"},
+		{"AC50.0000", "%"},
+		{"AC", "AC=50"},
+		{"DE", "DE=25"},
+		{"DI20000", "%"},
+		{"VE1.0000", "%"},
+		{"FL", "%"},
+		{"BS", "BS=63"},
+		{"SC", "SC=0009"},
+		{"AC25.0000", "%"},
+		{"IP", "IP=00004E20"},
+	})
+	s.moveTimeoutFactor = defaultMoveTimeoutFactor
+	fake := &fakeFollower{}
+	s.follower = &follower{name: "follower", motor: fake, ratio: -2}
+
+	// The follower goes the other way, twice as far and twice as fast, and speeds up twice as hard.
+	extra := map[string]interface{}{"acceleration": 50.0, "label": "a"}
+	assert.Nil(t, s.GoFor(ctx, 60, 1, extra))
+	assert.Equal(t, 120.0, fake.rpm)
+	assert.Equal(t, -2.0, fake.revs)
+	assert.Equal(t, map[string]interface{}{"acceleration": 100.0, "label": "a"}, fake.extra)
+	assert.Equal(t, 50.0, extra["acceleration"], "the leader's extra shouldn't change")
+	assert.Nil(t, s.comm.Close())
+}
+
+func TestFollowerDrift(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		{"IP", "IP=00004E20"},
+		{"IP", "IP=00004E20"},
+	})
+	fake := &fakeFollower{position: -2.5}
+	s.follower = &follower{name: "follower", motor: fake, ratio: -2}
+
+	// Without a maximum, drift is only logged.
+	assert.Nil(t, s.checkDrift(ctx))
+	s.follower.maxDrift = 0.1
+	assert.ErrorIs(t, s.checkDrift(ctx), ErrFollowerDrift)
+	assert.Nil(t, s.comm.Close())
+}
+
+func TestFollowerFailureCancelsLeader(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		{"SK", "%"},
+		{"AC", "AC=25"},
+		{"DE", "DE=25"},
+		{"DI20000", "%"},
+		{"VE1.0000", "%"},
+		{"FL", "%"},
+		// The follower fails partway through the move, so the leader is stopped too.
+		{"SK", "%"},
+	})
+	s.moveTimeoutFactor = defaultMoveTimeoutFactor
+	fake := &fakeFollower{goFor: func(ctx context.Context) error {
+		assert.Eventually(t, func() bool { return replayed(s) == 6 }, time.Second, time.Millisecond)
+		return errors.New("fault")
+	}}
+	s.follower = &follower{name: "follower", motor: fake, ratio: 1}
+
+	err := s.GoFor(ctx, 60, 1, nil)
+	assert.ErrorContains(t, err, "follower follower: fault")
+	assert.ErrorIs(t, err, context.Canceled, "the leader's move should have been canceled")
+	assert.True(t, fake.stopped)
+	assert.Nil(t, s.comm.Close())
+}
+
+func TestFollowerDriftInUserUnits(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		{"IP", "IP=00004E20"},
+		{"IP", "IP=00004E20"},
+	})
+	// One motor revolution is 0.5 mm of the leader, which should be 1 unit of the follower.
+	s.units = userUnits{gearRatio: 10, unitsPerRev: 5, label: "mm"}
+	s.updateConversion()
+	fake := &fakeFollower{position: 1.2}
+	s.follower = &follower{name: "follower", motor: fake, ratio: 2, maxDrift: 0.25}
+
+	assert.Nil(t, s.checkDrift(ctx))
+	fake.position = 1.3
+	err := s.checkDrift(ctx)
+	assert.ErrorIs(t, err, ErrFollowerDrift)
+	assert.ErrorContains(t, err, "is 0.300000 (in its own units)")
+	assert.Nil(t, s.comm.Close())
+}
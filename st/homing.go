@@ -0,0 +1,67 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// The SH (seek home) command takes the input to watch and the condition to wait for, such as
+// "X6L" to move until input X6 goes low, or "X3F" to move until it sees a falling edge on X3.
+var homeInputPattern = regexp.MustCompile(`^[XY][0-9]+[LHFR]$`)
+
+func validateHomeInput(input string) error {
+	if input == "" {
+		return nil
+	}
+	if !homeInputPattern.MatchString(input) {
+		return fmt.Errorf("home_input must look like X6L (an input followed by L, H, F or R), got %#v", input)
+	}
+	return nil
+}
+
+// home moves the motor until the home sensor triggers, and then sets that position to 0. The
+// direction to move is taken from the sign of homeRpm.
+func (s *st) home(ctx context.Context) error {
+	if s.homeInput == "" {
+		return errors.New("no home_input is configured")
+	}
+	if err := s.checkEStop(); err != nil {
+		return err
+	}
+	if err := s.checkHostMoves(); err != nil {
+		return err
+	}
+	if err := s.stopMovement(ctx); err != nil {
+		return err
+	}
+
+	if err := s.releaseBrake(ctx); err != nil {
+		return err
+	}
+
+	// SH uses the sign of DI for its direction and VE for its speed, like a normal move.
+	direction := 1
+	if s.homeRpm < 0 {
+		direction = -1
+	}
+	if _, err := s.comm.send(ctx, fmt.Sprintf("DI%d", direction)); err != nil {
+		return err
+	}
+	rpm := s.rpmLimits.Bound(s.homeRpm*float64(direction), s.logger)
+	if err := s.comm.store(ctx, "VE", rpm/60); err != nil {
+		return err
+	}
+	if err := s.comm.set(ctx, "SH", s.homeInput); err != nil {
+		return err
+	}
+	// We have no idea how far away the sensor is, so there's no sensible timeout here.
+	if err := s.waitForMoveCommandToComplete(ctx, 0); err != nil {
+		return err
+	}
+	s.setDirection(direction)
+
+	s.logger.Info("Homing complete, setting the position to 0")
+	return s.resetZeroPosition(ctx, 0)
+}
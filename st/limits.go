@@ -1,9 +1,16 @@
 package st
 
 import (
+	"errors"
+	"fmt"
+
 	"go.viam.com/rdk/logging"
 )
 
+// ErrOutsideLimits is returned instead of bounding a value when the move's extra sets
+// "strict_limits", such as for coordinated moves that bounding would throw out of sync.
+var ErrOutsideLimits = errors.New("outside of the configured limits")
+
 type limits struct {
 	name string
 	min  float64
@@ -18,6 +25,18 @@ func newLimits(name string, min, max float64) limits {
 	}
 }
 
+// Check returns an error if the value is above the max or below the min, for callers that would
+// rather fail than have Bound change the value. Like Bound, it ignores floats that are 0.
+func (l *limits) Check(value float64) error {
+	if value == 0 {
+		return nil
+	}
+	if (l.min != 0 && value < l.min) || (l.max != 0 && value > l.max) {
+		return fmt.Errorf("%s of %f is %w (min %f, max %f)", l.name, value, ErrOutsideLimits, l.min, l.max)
+	}
+	return nil
+}
+
 // Bound returns the value, unless it is above the max or below the min, in which case it logs a
 // warning and returns one of those instead. Any floats that are 0 are ignored (so, a min of 0 is
 // skipped, a max of 0 is skipped, and a value of 0 is returned immediately).
@@ -0,0 +1,252 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/utils"
+)
+
+// The upper bounds of the latency histogram buckets, in seconds. Anything slower than the last
+// bucket only shows up in the +Inf bucket.
+var latencyBuckets = []float64{0.001, 0.002, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1}
+
+type commandMetrics struct {
+	count   uint64
+	errors  uint64
+	nacks   uint64
+	latency float64  // Total, in seconds
+	buckets []uint64 // Not cumulative: a request is only counted in the first bucket it fits in
+}
+
+// metrics counts the traffic on the link to the drive. It belongs to the st rather than to the
+// comm port, so the counts survive reconnecting.
+type metrics struct {
+	mu         sync.Mutex
+	commands   map[string]*commandMetrics
+	reconnects uint64
+	bytesOut   uint64
+	bytesIn    uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{commands: map[string]*commandMetrics{}}
+}
+
+// commandName returns the SCL mnemonic of a command, without its arguments (e.g., "DI" for
+// "DI2000"), so that all uses of a command are counted together.
+func commandName(command string) string {
+	if len(command) > 2 {
+		return command[:2]
+	}
+	return command
+}
+
+// record counts a single command sent to the drive. It is safe to call on a nil *metrics.
+func (m *metrics) record(
+	command string, latency time.Duration, bytesOut, bytesIn int, response string, err error,
+) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := commandName(command)
+	c, ok := m.commands[name]
+	if !ok {
+		c = &commandMetrics{buckets: make([]uint64, len(latencyBuckets)+1)}
+		m.commands[name] = c
+	}
+	c.count++
+	if err != nil {
+		c.errors++
+	}
+	// The drive replies with a "?" when it doesn't accept a command.
+	if strings.HasPrefix(response, "?") {
+		c.nacks++
+	}
+	seconds := latency.Seconds()
+	c.latency += seconds
+	c.buckets[sort.SearchFloat64s(latencyBuckets, seconds)]++
+
+	m.bytesOut += uint64(bytesOut)
+	m.bytesIn += uint64(bytesIn)
+}
+
+func (m *metrics) recordReconnect() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reconnects++
+}
+
+func (m *metrics) sortedNames() []string {
+	names := make([]string, 0, len(m.commands))
+	for name := range m.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// summary returns the metrics in a form that can be returned from DoCommand.
+func (m *metrics) summary() map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	commands := map[string]interface{}{}
+	for _, name := range m.sortedNames() {
+		c := m.commands[name]
+		buckets := map[string]interface{}{}
+		var cumulative uint64
+		for i, count := range c.buckets {
+			cumulative += count
+			buckets[bucketLabel(i)] = float64(cumulative)
+		}
+		commands[name] = map[string]interface{}{
+			"count":           float64(c.count),
+			"errors":          float64(c.errors),
+			"nacks":           float64(c.nacks),
+			"mean_latency_ms": c.latency / float64(c.count) * 1000,
+			"latency_buckets": buckets,
+		}
+	}
+	return map[string]interface{}{
+		"commands":       commands,
+		"reconnects":     float64(m.reconnects),
+		"bytes_sent":     float64(m.bytesOut),
+		"bytes_received": float64(m.bytesIn),
+	}
+}
+
+func bucketLabel(i int) string {
+	if i == len(latencyBuckets) {
+		return "+Inf"
+	}
+	return fmt.Sprint(latencyBuckets[i])
+}
+
+// prometheus writes the metrics in the Prometheus text exposition format.
+func (m *metrics) prometheus(motorName string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	header := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	perCommand := func(name, help string, value func(*commandMetrics) uint64) {
+		header(name, "counter", help)
+		for _, command := range m.sortedNames() {
+			fmt.Fprintf(&b, "%s{motor=%q,command=%q} %d\n",
+				name, motorName, command, value(m.commands[command]))
+		}
+	}
+
+	perCommand("appliedmotion_commands_total", "Commands sent to the drive.",
+		func(c *commandMetrics) uint64 { return c.count })
+	perCommand("appliedmotion_command_errors_total", "Commands that failed to get a response.",
+		func(c *commandMetrics) uint64 { return c.errors })
+	perCommand("appliedmotion_command_nacks_total", "Commands the drive refused.",
+		func(c *commandMetrics) uint64 { return c.nacks })
+
+	header("appliedmotion_command_latency_seconds", "histogram",
+		"Time from sending a command to receiving its response.")
+	for _, command := range m.sortedNames() {
+		c := m.commands[command]
+		var cumulative uint64
+		for i, count := range c.buckets {
+			cumulative += count
+			fmt.Fprintf(&b, "appliedmotion_command_latency_seconds_bucket{motor=%q,command=%q,le=%q} %d\n",
+				motorName, command, bucketLabel(i), cumulative)
+		}
+		fmt.Fprintf(&b, "appliedmotion_command_latency_seconds_sum{motor=%q,command=%q} %g\n",
+			motorName, command, c.latency)
+		fmt.Fprintf(&b, "appliedmotion_command_latency_seconds_count{motor=%q,command=%q} %d\n",
+			motorName, command, c.count)
+	}
+
+	total := func(name, help string, value uint64) {
+		header(name, "counter", help)
+		fmt.Fprintf(&b, "%s{motor=%q} %d\n", name, motorName, value)
+	}
+	total("appliedmotion_reconnects_total", "Times the link to the drive was reopened.", m.reconnects)
+	total("appliedmotion_bytes_sent_total", "Bytes sent to the drive.", m.bytesOut)
+	total("appliedmotion_bytes_received_total", "Bytes received from the drive.", m.bytesIn)
+	return b.String()
+}
+
+// The metrics are only served to this machine, unless metrics_host says otherwise.
+const defaultMetricsHost = "127.0.0.1"
+
+// metricsServer serves the metrics over HTTP at /metrics, for Prometheus to scrape.
+type metricsServer struct {
+	addr      string
+	motorName string
+	server    *http.Server
+}
+
+func startMetricsServer(
+	addr string, m *metrics, motorName string, logger logging.Logger,
+) (*metricsServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, m.prometheus(motorName))
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	utils.PanicCapturingGo(func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Metrics server stopped: %v", err)
+		}
+	})
+	logger.Infof("Serving metrics on %s", addr)
+	return &metricsServer{addr: addr, motorName: motorName, server: server}, nil
+}
+
+// updateMetricsServer starts, stops or restarts the metrics server so that it matches the config.
+// The caller must hold the mutex.
+func (s *st) updateMetricsServer(host string, port int) error {
+	name := s.Name().ShortName()
+	if host == "" {
+		host = defaultMetricsHost
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	if s.metricsServer != nil {
+		if s.metricsServer.addr == addr && s.metricsServer.motorName == name {
+			return nil
+		}
+		if err := s.metricsServer.close(); err != nil {
+			return err
+		}
+		s.metricsServer = nil
+	}
+	if port == 0 {
+		return nil
+	}
+	server, err := startMetricsServer(addr, s.metrics, name, s.logger)
+	if err != nil {
+		return err
+	}
+	s.metricsServer = server
+	return nil
+}
+
+func (ms *metricsServer) close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return ms.server.Shutdown(ctx)
+}
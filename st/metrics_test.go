@@ -0,0 +1,69 @@
+package st
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/resource"
+)
+
+func TestMetrics(t *testing.T) {
+	m := newMetrics()
+	m.record("DI2000", 3*time.Millisecond, 9, 4, "%", nil)
+	m.record("DI-100", 300*time.Millisecond, 9, 5, "?4", nil)
+	m.record("IP", 0, 5, 0, "", errors.New("timeout"))
+	m.recordReconnect()
+
+	summary := m.summary()
+	assert.Equal(t, float64(1), summary["reconnects"])
+	assert.Equal(t, float64(23), summary["bytes_sent"])
+	assert.Equal(t, float64(9), summary["bytes_received"])
+
+	di := summary["commands"].(map[string]interface{})["DI"].(map[string]interface{})
+	assert.Equal(t, float64(2), di["count"])
+	assert.Equal(t, float64(1), di["nacks"])
+	assert.Equal(t, float64(0), di["errors"])
+	assert.InDelta(t, 151.5, di["mean_latency_ms"], 1e-6)
+	buckets := di["latency_buckets"].(map[string]interface{})
+	assert.Equal(t, float64(0), buckets["0.002"])
+	assert.Equal(t, float64(1), buckets["0.005"])
+	assert.Equal(t, float64(2), buckets["0.5"])
+
+	text := m.prometheus("x")
+	assert.True(t, strings.Contains(text, `appliedmotion_command_errors_total{motor="x",command="IP"} 1`))
+	assert.True(t, strings.Contains(text,
+		`appliedmotion_command_latency_seconds_bucket{motor="x",command="DI",le="+Inf"} 2`))
+	assert.True(t, strings.Contains(text, `appliedmotion_reconnects_total{motor="x"} 1`))
+}
+
+func TestMetricsServer(t *testing.T) {
+	s := replayMotor(t, nil)
+	s.Named = resource.NewName(resource.APINamespaceRDK.WithComponentType("motor"), "m").AsNamed()
+	s.metrics = newMetrics()
+
+	// Find a free port to serve on.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	assert.Nil(t, listener.Close())
+
+	// Without metrics_host, only this machine can scrape the metrics.
+	assert.Nil(t, s.updateMetricsServer("", port))
+	assert.Equal(t, fmt.Sprintf("127.0.0.1:%d", port), s.metricsServer.addr)
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", port))
+	assert.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Body.Close())
+	assert.Contains(t, string(body), `appliedmotion_reconnects_total{motor="m"} 0`)
+
+	assert.Nil(t, s.updateMetricsServer("", 0))
+	assert.Nil(t, s.metricsServer)
+}
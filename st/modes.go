@@ -0,0 +1,144 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrIncompatibleControlMode is returned when asked to move the motor while the drive is taking
+// its motion commands from somewhere other than us (e.g., an analog input).
+var ErrIncompatibleControlMode = errors.New("drive is not in a control mode that accepts host moves")
+
+// controlMode is the value used by the CM command, which decides where the drive gets its motion
+// commands from. See the CM section of
+// https://appliedmotion.s3.amazonaws.com/Host-Command-Reference_920-0002W_0.pdf for the full list.
+type controlMode int
+
+const (
+	modeUnknown        controlMode = 0
+	modeStepDirection  controlMode = 7
+	modeCwCcwPulse     controlMode = 8
+	modeQuadrature     controlMode = 9
+	modeAnalogVelocity controlMode = 11
+	modePointToPoint   controlMode = 21
+	modeAnalogPosition controlMode = 22
+)
+
+var controlModeNames = map[controlMode]string{
+	modeStepDirection:  "step_direction",
+	modeCwCcwPulse:     "cw_ccw_pulse",
+	modeQuadrature:     "quadrature",
+	modeAnalogVelocity: "analog_velocity",
+	modePointToPoint:   "point_to_point",
+	modeAnalogPosition: "analog_position",
+}
+
+func (m controlMode) String() string {
+	if name, ok := controlModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("CM%d", int(m))
+}
+
+func parseControlMode(name string) (controlMode, error) {
+	for mode, modeName := range controlModeNames {
+		if strings.EqualFold(name, modeName) {
+			return mode, nil
+		}
+	}
+	return modeUnknown, fmt.Errorf("unknown control mode %#v", name)
+}
+
+// isPulseFollowing returns whether the drive is following pulses from an external source, in which
+// case the EG command sets the electronic gearing between those pulses and the motor.
+func (m controlMode) isPulseFollowing() bool {
+	switch m {
+	case modeStepDirection, modeCwCcwPulse, modeQuadrature:
+		return true
+	default:
+		return false
+	}
+}
+
+// acceptsHostMoves returns whether GoFor, GoTo and SetPower make sense in this mode. We only
+// refuse the modes we know take their motion commands from elsewhere: if the drive is in some
+// mode we don't know about, we let the user try.
+func (m controlMode) acceptsHostMoves() bool {
+	switch m {
+	case modeStepDirection, modeCwCcwPulse, modeQuadrature, modeAnalogVelocity, modeAnalogPosition:
+		return false
+	default:
+		return true
+	}
+}
+
+// checkHostMoves returns an error if the drive is in a control mode that will ignore the motion
+// commands we're about to send it.
+func (s *st) checkHostMoves() error {
+	if !s.mode.acceptsHostMoves() {
+		return fmt.Errorf("%w: drive is in %s mode (switch back with set_mode %s first)",
+			ErrIncompatibleControlMode, s.mode, modePointToPoint)
+	}
+	return nil
+}
+
+// readControlMode asks the drive which control mode it is currently in.
+func (s *st) readControlMode(ctx context.Context) (controlMode, error) {
+	resp, err := s.comm.query(ctx, "CM")
+	if err != nil {
+		return modeUnknown, err
+	}
+	mode, err := strconv.Atoi(strings.TrimSpace(resp))
+	if err != nil {
+		return modeUnknown, err
+	}
+	return controlMode(mode), nil
+}
+
+// setControlMode stops any current motion and switches the drive to the given control mode. When
+// switching into a pulse following mode, pulsesPerRev (if nonzero) sets the electronic gearing:
+// the number of input pulses that turn the motor one revolution.
+func (s *st) setControlMode(ctx context.Context, mode controlMode, pulsesPerRev int64) error {
+	if pulsesPerRev < 0 {
+		return fmt.Errorf("pulses_per_rev must be > 0, got %d", pulsesPerRev)
+	}
+	if pulsesPerRev != 0 && !mode.isPulseFollowing() {
+		return fmt.Errorf("pulses_per_rev only applies to pulse following modes, not %s", mode)
+	}
+
+	if err := s.stopMovement(ctx); err != nil {
+		return err
+	}
+
+	// EG sets the resolution of every move, not just of pulse following. If we changed it on the
+	// way into pulse following, put it back on the way out so GoFor and GoTo move the right
+	// distance again.
+	gearing := pulsesPerRev
+	if !mode.isPulseFollowing() && s.mode.isPulseFollowing() {
+		gearing = s.stepsPerRev
+	}
+	if gearing != 0 {
+		if err := s.comm.set(ctx, "EG", strconv.FormatInt(gearing, 10)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.comm.set(ctx, "CM", strconv.Itoa(int(mode))); err != nil {
+		return err
+	}
+	s.logger.Infof("Switched drive from %s to %s mode", s.mode, mode)
+	s.mode = mode
+	return nil
+}
+
+// readGearing returns the current electronic gearing (EG) of the drive, in pulses per revolution.
+func (s *st) readGearing(ctx context.Context) (int64, error) {
+	resp, err := s.comm.query(ctx, "EG")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(resp), 10, 64)
+}
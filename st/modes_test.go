@@ -0,0 +1,84 @@
+package st
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControlModes(t *testing.T) {
+	mode, err := parseControlMode("Analog_Velocity")
+	assert.Nil(t, err)
+	assert.Equal(t, modeAnalogVelocity, mode)
+	_, err = parseControlMode("CM11")
+	assert.ErrorContains(t, err, "unknown control mode")
+	assert.Equal(t, "CM3", controlMode(3).String())
+
+	s := &st{}
+	for _, mode := range []controlMode{modePointToPoint, modeUnknown, controlMode(3)} {
+		s.mode = mode
+		assert.Nil(t, s.checkHostMoves(), "%s should accept host moves", mode)
+	}
+	for _, mode := range []controlMode{modeAnalogVelocity, modeAnalogPosition} {
+		s.mode = mode
+		assert.ErrorIs(t, s.checkHostMoves(), ErrIncompatibleControlMode, "%s should refuse host moves", mode)
+	}
+}
+
+func TestPulseFollowing(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		// Into step and direction, at 4000 pulses per revolution
+		{"SK", "%"},
+		{"EG4000", "%"},
+		{"CM7", "%"},
+		// get_mode
+		{"CM", "CM=7"},
+		{"EG", "EG=4000"},
+		// Back to point to point, which puts back the steps per revolution
+		{"SK", "%"},
+		{"EG20000", "%"},
+		{"CM21", "%"},
+	})
+	s.mode = modePointToPoint
+
+	resp, err := s.DoCommand(ctx, map[string]interface{}{
+		"command": "set_mode", "mode": "step_direction", "pulses_per_rev": 4000.0,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "step_direction", resp["mode"])
+
+	// The drive is following pulses, so moves from us are refused before anything is sent.
+	for _, mode := range []controlMode{modeStepDirection, modeCwCcwPulse, modeQuadrature} {
+		assert.True(t, mode.isPulseFollowing())
+		assert.False(t, mode.acceptsHostMoves())
+	}
+	assert.ErrorIs(t, s.GoFor(ctx, 60, 1, nil), ErrIncompatibleControlMode)
+	assert.ErrorIs(t, s.SetPower(ctx, 0.5, nil), ErrIncompatibleControlMode)
+
+	resp, err = s.DoCommand(ctx, map[string]interface{}{"command": "get_mode"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"mode": "step_direction", "cm": 7, "accepts_host_moves": false, "pulses_per_rev": int64(4000),
+	}, resp)
+
+	_, err = s.DoCommand(ctx, map[string]interface{}{"command": "set_mode", "mode": "point_to_point"})
+	assert.Nil(t, err)
+	assert.Nil(t, s.checkHostMoves())
+
+	// Gearing only makes sense for pulse following, and has to be a positive whole number.
+	_, err = s.DoCommand(ctx, map[string]interface{}{
+		"command": "set_mode", "mode": "analog_velocity", "pulses_per_rev": 4000.0,
+	})
+	assert.ErrorContains(t, err, "only applies to pulse following modes")
+	_, err = s.DoCommand(ctx, map[string]interface{}{
+		"command": "set_mode", "mode": "quadrature", "pulses_per_rev": -1.0,
+	})
+	assert.ErrorContains(t, err, "must be > 0")
+	_, err = s.DoCommand(ctx, map[string]interface{}{
+		"command": "set_mode", "mode": "quadrature", "pulses_per_rev": 1.5,
+	})
+	assert.ErrorContains(t, err, "must be an integer")
+	assert.Nil(t, s.comm.Close())
+}
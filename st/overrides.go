@@ -3,102 +3,163 @@ package st
 import (
 	"context"
 	"fmt"
-	"strconv"
+	"time"
 
 	"go.uber.org/multierr"
 )
 
-type oldAcceleration struct {
-	acceleration float64
-	deceleration float64
-	// Perhaps more parameters will go here.
+// moveOverride is a parameter that can be changed for a single GoFor or GoTo through its extra
+// map. It is set before the move and restored afterwards.
+type moveOverride struct {
+	key string
+	scl string
 }
 
-// Returns the accel/decel values from the extra map.
-func convertExtras(extra map[string]interface{}) (float64, float64, error) {
-	var err error
+var moveOverrides = []moveOverride{
+	{key: "acceleration", scl: "AC"},
+	{key: "deceleration", scl: "DE"},
+	{key: "stop_deceleration", scl: "AM"},
+	{key: "velocity", scl: "VE"},
+	{key: "jerk_filter_hz", scl: "KJ"},
+	{key: "run_current", scl: "CC"},
+	{key: "idle_current", scl: "CI"},
+	{key: "jog_acceleration", scl: "JA"},
+	{key: "jog_deceleration", scl: "JL"},
+	{key: "jog_velocity", scl: "JS"},
+}
 
-	getValue := func(key string) float64 {
-		val, exists := extra[key]
-		if !exists {
-			return 0.0
-		}
+// How long to spend restoring overrides after the move's context has already been canceled.
+const restoreTimeout = 5 * time.Second
 
-		realVal, ok := val.(float64)
-		if !ok {
-			err = multierr.Combine(err, fmt.Errorf("non-float64 value for %s: %#v", key, val))
-			return 0.0
-		}
-		return realVal
+// savedParam is the value a parameter had before it was overridden.
+type savedParam struct {
+	scl   string
+	value float64
+}
+
+type savedParams []savedParam
+
+// extraFloat returns the value of key in the extra map, or 0 if it isn't there.
+func extraFloat(extra map[string]interface{}, key string) (float64, error) {
+	val, exists := extra[key]
+	if !exists {
+		return 0.0, nil
 	}
 
-	return getValue("acceleration"), getValue("deceleration"), err
+	realVal, ok := val.(float64)
+	if !ok {
+		return 0.0, fmt.Errorf("non-float64 value for %s: %#v", key, val)
+	}
+	return realVal, nil
 }
 
-func setOverrides(
-	ctx context.Context, comms commPort, extra map[string]interface{},
-) (oldAcceleration, error) {
-	accel, decel, err := convertExtras(extra)
+// strictLimits returns whether the extra map asks for speeds and accelerations outside of the
+// configured limits to be refused with ErrOutsideLimits, rather than bounded.
+func strictLimits(extra map[string]interface{}) bool {
+	strict, _ := extra["strict_limits"].(bool)
+	return strict
+}
 
-	// This function does the heavy lifting of writing to the device and updating err. It returns
-	// values to put into the old state.
-	store := func (value float64, command string) float64 {
-		if value == 0.0 {
-			return 0.0 // Don't change anything
+// Returns the accel/decel values from the extra map.
+func convertExtras(extra map[string]interface{}) (float64, float64, error) {
+	accel, accelErr := extraFloat(extra, "acceleration")
+	decel, decelErr := extraFloat(extra, "deceleration")
+	return accel, decel, multierr.Combine(accelErr, decelErr)
+}
+
+// setOverrides sets every override in the extra map, and returns the values they replaced. The
+// values are given in user units. Even if it returns an error, the returned values must be
+// restored, since some overrides may already have been set.
+func (s *st) setOverrides(ctx context.Context, extra map[string]interface{}) (savedParams, error) {
+	var saved savedParams
+	for _, o := range moveOverrides {
+		userValue, err := extraFloat(extra, o.key)
+		if err != nil {
+			return saved, err
+		}
+		// This can't fail, since every override is in the parameter table.
+		p, _ := lookupParam(o.scl)
+		if _, exists := extra[o.key]; !exists || (userValue == 0 && p.min > 0) {
+			// 0 isn't a valid value for this parameter, so treat it like it wasn't set at all.
+			continue
 		}
 
-		response, sendErr := replaceValue(ctx, comms, command, value)
-		err = multierr.Combine(err, sendErr)
-		if response[:3] != command + "=" {
-			// The response we got back does not match the request we sent (e.g., we sent an "AC"
-			// request but did not get an "AC=" response). Something has gone very wrong.
-			err = multierr.Combine(err, fmt.Errorf("unexpected response to %s: %#v",
-												   command, response))
-			return 0.0
+		value := p.fromUser(s.units, userValue)
+		switch o.scl {
+		case "AC":
+			if strictLimits(extra) {
+				if err := s.accelLimits.Check(value); err != nil {
+					return saved, err
+				}
+			}
+			value = s.accelLimits.Bound(value, s.logger)
+		case "DE", "AM":
+			if strictLimits(extra) {
+				if err := s.decelLimits.Check(value); err != nil {
+					return saved, err
+				}
+			}
+			value = s.decelLimits.Bound(value, s.logger)
+		case "VE":
+			// The move sends its speed itself, within the rpm limits, so only remember the old one.
+			if err := p.check(value); err != nil {
+				return saved, fmt.Errorf("unable to override %s: %w", o.key, err)
+			}
+			oldValue, err := readParam(ctx, s.comm, p)
+			if err != nil {
+				return saved, fmt.Errorf("unable to override %s: %w", o.key, err)
+			}
+			saved = append(saved, savedParam{scl: o.scl, value: oldValue})
+			continue
+		case "CC", "CI":
+			if err := s.drive.caps.checkCurrent(value); err != nil {
+				return saved, fmt.Errorf("%s: %w", o.key, err)
+			}
 		}
 
-		oldValue, convErr := strconv.ParseFloat(response[3:], 64)
-		if convErr != nil {
-			err = multierr.Combine(err, convErr)
-			return 0.0
+		oldValue, err := replaceValue(ctx, s.comm, o.scl, value)
+		if err != nil {
+			return saved, fmt.Errorf("unable to override %s: %w", o.key, err)
 		}
-		return oldValue
+		saved = append(saved, savedParam{scl: o.scl, value: oldValue})
 	}
-
-	var os oldAcceleration
-	os.acceleration = store(accel, "AC")
-	os.deceleration = store(decel, "DE")
-	return os, err
+	return saved, nil
 }
 
-func (os *oldAcceleration) restore(ctx context.Context, comms commPort) error {
-	// This function does all the heavy lifting of restoring the old state.
-	restore := func (command string, value float64) error {
-		if value == 0.0 {
-			return nil // No old state stored
-		}
-		return comms.store(ctx, command, value)
-	}
+// restore puts back every parameter that was overridden, in the reverse order they were set. The
+// move may have been canceled, but the overrides still need to be undone, so this doesn't use
+// ctx's cancellation.
+func (saved savedParams) restore(ctx context.Context, comms commPort) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), restoreTimeout)
+	defer cancel()
 
-	return multierr.Combine(
-		restore("AC", os.acceleration),
-		restore("DE", os.deceleration),
-	)
+	var err error
+	for i := len(saved) - 1; i >= 0; i-- {
+		err = multierr.Combine(err, comms.store(ctx, saved[i].scl, saved[i].value))
+	}
+	return err
 }
 
-// replaceValue first sends on the commPort a version of the command with no arguments, then the
-// entire command, and returns what it received from the first one. It is intended to be used to
-// temporarily override some state in the motor controller.
-// Example use: ReplaceValue(s, "AC100") sets the acceleration to 100 revs/sec^2 and returns the
-// previous acceleration value. Later, you can use that return value to restore the acceleration to
-// its original setting.
-func replaceValue(ctx context.Context, s commPort, command string, value float64) (string, error) {
-	response, err := s.send(ctx, command)
+// replaceValue reads the current value of a parameter, then sets the new one, and returns the
+// old value. It is intended to be used to temporarily override some state in the motor
+// controller.
+// Example use: replaceValue(ctx, s, "AC", 100) sets the acceleration to 100 revs/sec^2 and returns
+// the previous acceleration value. Later, you can use that return value to restore the
+// acceleration to its original setting.
+func replaceValue(ctx context.Context, s commPort, command string, value float64) (float64, error) {
+	p, ok := lookupParam(command)
+	if !ok {
+		return 0, fmt.Errorf("unknown parameter %s", command)
+	}
+	if err := p.check(value); err != nil {
+		return 0, err
+	}
+	oldValue, err := readParam(ctx, s, p)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 	if err := s.store(ctx, command, value); err != nil {
-		return "", err
+		return 0, err
 	}
-	return response, nil
+	return oldValue, nil
 }
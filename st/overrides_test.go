@@ -0,0 +1,100 @@
+package st
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverridesRestoredAfterFailure(t *testing.T) {
+	s := replayMotor(t, [][2]string{
+		{"AC", "AC=25.000"},
+		{"AC10.0000", "%"},
+		{"CC", "CC=2.000"},
+		{"CC3.0000", "?4"}, // The drive refuses the new current
+		{"AC25.0000", "%"}, // So the acceleration is put back
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	saved, err := s.setOverrides(ctx, map[string]interface{}{"acceleration": 10.0, "run_current": 3.0})
+	assert.ErrorContains(t, err, "unable to override run_current")
+
+	// Restoring still works after the move's context is canceled.
+	cancel()
+	assert.Nil(t, saved.restore(ctx, s.comm))
+	assert.Nil(t, s.comm.Close())
+
+	s = replayMotor(t, nil)
+	_, err = s.setOverrides(context.Background(), map[string]interface{}{"run_current": "3"})
+	assert.EqualError(t, err, `non-float64 value for run_current: "3"`)
+}
+
+func TestOverrideNames(t *testing.T) {
+	// Each override uses the same name in extra as the parameter does in get_param and set_param.
+	for _, o := range moveOverrides {
+		p, ok := lookupParam(o.key)
+		assert.True(t, ok, o.key)
+		assert.Equal(t, o.scl, p.scl, o.key)
+	}
+}
+
+func TestStrictLimits(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{{"SK", "%"}})
+	s.accelLimits = newLimits("acceleration", 0, 5)
+	s.rpmLimits = newLimits("rpm", 30, 600)
+
+	// Coordinated moves would rather fail than be bounded, since that throws them out of step.
+	strict := map[string]interface{}{"acceleration": 10.0, "strict_limits": true}
+	_, err := s.setOverrides(ctx, strict)
+	assert.ErrorIs(t, err, ErrOutsideLimits)
+	err = s.configuredMove(ctx, "FL", 1, 10, map[string]interface{}{"strict_limits": true})
+	assert.ErrorIs(t, err, ErrOutsideLimits)
+	assert.ErrorContains(t, err, "rpm of 10.000000")
+	assert.Nil(t, s.comm.Close(), "nothing should have been set")
+}
+
+func TestJerkFilterOverride(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		{"SK", "%"},
+		{"KJ", "KJ=50"},
+		{"KJ20.0000", "%"},
+		{"AC", "AC=25"},
+		{"DE", "DE=25"},
+		{"DI20000", "%"},
+		{"VE1.0000", "%"},
+		{"FL", "%"},
+		{"BS", "BS=63"},
+		{"SC", "SC=0009"},
+		{"KJ50.0000", "%"},
+	})
+	s.moveTimeoutFactor = defaultMoveTimeoutFactor
+
+	// The filter is set for just this move, and then put back.
+	assert.Nil(t, s.GoFor(ctx, 60, 1, map[string]interface{}{"jerk_filter_hz": 20.0}))
+	assert.Nil(t, s.comm.Close())
+}
+
+func TestVelocityOverride(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		{"SK", "%"},
+		{"VE", "VE=1.5"},
+		{"AC", "AC=25"},
+		{"DE", "DE=25"},
+		{"DI20000", "%"},
+		{"VE2.0000", "%"},
+		{"FL", "%"},
+		{"BS", "BS=63"},
+		{"SC", "SC=0009"},
+		{"VE1.5000", "%"},
+	})
+	s.moveTimeoutFactor = defaultMoveTimeoutFactor
+
+	// The move goes at the overridden speed rather than the rpm it was given, and the drive's
+	// speed is put back afterwards.
+	assert.Nil(t, s.GoFor(ctx, 60, 1, map[string]interface{}{"velocity": 2.0}))
+	assert.Nil(t, s.comm.Close())
+}
@@ -0,0 +1,246 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// backupParameters are the settable parameters that are backed up and restored, in the order they
+// are restored. The control mode comes first, since changing it can change how the drive treats
+// the others.
+var backupParameters = []string{
+	"CM", // Control mode
+	"EG", // Electronic gearing (steps per revolution)
+	"AC", // Acceleration
+	"DE", // Deceleration
+	"AM", // Maximum deceleration, used when stopping
+	"VE", // Velocity
+	"JA", // Jog acceleration
+	"JL", // Jog deceleration
+	"JS", // Jog speed
+	"CC", // Running current
+	"CI", // Idle current
+	"CD", // Idle current delay
+	"KJ", // Jerk filter
+	"PM", // Power-up mode
+	"DL", // Limit switch configuration
+	"SI", // Enable input usage
+	"AI", // Alarm reset input usage
+	"AO", // Alarm output usage
+	"MO", // Motion output usage
+	"BO", // Brake output usage
+}
+
+func isBackupParameter(name string) bool {
+	for _, p := range backupParameters {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sameParameterValue compares two values of a parameter. Numbers are compared numerically, since
+// the drive reports them with its own formatting (e.g., "25.000" when we set "25").
+func sameParameterValue(a, b string) bool {
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+	if errX == nil && errY == nil {
+		// The drive rounds to 3 decimal places.
+		return math.Abs(x-y) < 0.0015
+	}
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// formatParameterValue turns a parameter value from JSON into the text to send to the drive.
+func formatParameterValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("parameter values must be numbers or strings, got %#v", value)
+	}
+}
+
+// writeParameter sets a parameter, and then reads it back to check the drive took the new value.
+func (s *st) writeParameter(ctx context.Context, name, value string) error {
+	if err := checkParameterText(name, value); err != nil {
+		return err
+	}
+	if err := s.drive.caps.checkCommand(name + value); err != nil {
+		return err
+	}
+	if err := s.comm.set(ctx, name, value); err != nil {
+		return err
+	}
+	actual, err := s.comm.query(ctx, name)
+	if err != nil {
+		return fmt.Errorf("unable to verify %s: %w", name, err)
+	}
+	if !sameParameterValue(value, actual) {
+		return fmt.Errorf("set %s to %s, but the drive reports %s", name, value, actual)
+	}
+	return nil
+}
+
+// backup reads every parameter in backupParameters. Parameters the drive doesn't support are
+// listed as skipped, rather than failing the whole backup.
+func (s *st) backup(ctx context.Context) map[string]interface{} {
+	parameters := map[string]interface{}{}
+	skipped := []interface{}{}
+	for _, name := range backupParameters {
+		value, err := s.comm.query(ctx, name)
+		if err != nil {
+			s.logger.Debugf("Not backing up %s: %v", name, err)
+			skipped = append(skipped, name)
+			continue
+		}
+		parameters[name] = value
+	}
+	return map[string]interface{}{
+		"parameters": parameters,
+		"skipped":    skipped,
+		"drive":      s.drive.toMap(),
+	}
+}
+
+// restoreParameters writes back the parameters from a backup, and checks each one. If save is set, the
+// parameters are then saved to the drive's flash memory with SA, so that they survive a power
+// cycle.
+func (s *st) restoreParameters(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	parameters, ok := args["parameters"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("restore_parameters needs a \"parameters\" map, as returned by backup_parameters")
+	}
+	values := map[string]string{}
+	for name, value := range parameters {
+		if !isBackupParameter(name) {
+			return nil, fmt.Errorf("unknown parameter %s", name)
+		}
+		text, err := formatParameterValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		values[name] = text
+	}
+
+	if err := s.stopMovement(ctx); err != nil {
+		return nil, err
+	}
+
+	restored := []interface{}{}
+	failed := map[string]interface{}{}
+	for _, name := range backupParameters {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		if err := s.writeParameter(ctx, name, value); err != nil {
+			failed[name] = err.Error()
+			continue
+		}
+		restored = append(restored, name)
+	}
+
+	if gearing, ok := values["EG"]; ok && !sameParameterValue(gearing, strconv.FormatInt(s.stepsPerRev, 10)) {
+		s.logger.Warnf("Restored EG%s, which doesn't match steps_per_rev (%d)", gearing, s.stepsPerRev)
+	}
+	// The control mode might have changed underneath us.
+	if mode, err := s.readControlMode(ctx); err == nil {
+		s.mode = mode
+	}
+
+	response := map[string]interface{}{"restored": restored, "failed": failed, "saved": false}
+	if len(failed) > 0 {
+		return response, fmt.Errorf("unable to restore %d parameters", len(failed))
+	}
+	if save, _ := args["save"].(bool); save {
+		if err := s.comm.set(ctx, "SA", ""); err != nil {
+			return response, fmt.Errorf("unable to save parameters: %w", err)
+		}
+		response["saved"] = true
+	}
+	return response, nil
+}
+
+var parameterNamePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// validateDriveParameters checks the drive_parameters config. The parameters that have their own
+// config fields can't be set here as well, since it would be ambiguous which one wins.
+func validateDriveParameters(conf *Config) error {
+	managed := map[string]bool{
+		"AC": conf.DefaultAcceleration > 0,
+		"DE": conf.DefaultDeceleration > 0,
+		"AM": conf.DefaultDeceleration > 0,
+		"KJ": conf.JerkFilter > 0,
+	}
+	for name, value := range conf.DriveParameters {
+		if !parameterNamePattern.MatchString(name) {
+			return fmt.Errorf("drive_parameters: %#v is not an SCL command", name)
+		}
+		if managed[name] {
+			return fmt.Errorf("drive_parameters: %s is already set by another config field", name)
+		}
+		text, err := formatParameterValue(value)
+		if err != nil {
+			return fmt.Errorf("drive_parameters: %s: %w", name, err)
+		}
+		if err := checkParameterText(name, text); err != nil {
+			return fmt.Errorf("drive_parameters: %w", err)
+		}
+	}
+	return nil
+}
+
+// orderParameters returns the names of the parameters in the order to write them: the ones we
+// back up in the same order as a restore, and then the rest alphabetically.
+func orderParameters(parameters map[string]interface{}) []string {
+	var known, others []string
+	for _, name := range backupParameters {
+		if _, ok := parameters[name]; ok {
+			known = append(known, name)
+		}
+	}
+	for name := range parameters {
+		if !isBackupParameter(name) {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	return append(known, others...)
+}
+
+// reconcileParameters makes the drive match the drive_parameters config. It reads each parameter
+// and only writes the ones that differ, so that the log shows exactly what the config changed.
+func (s *st) reconcileParameters(ctx context.Context, parameters map[string]interface{}) error {
+	var changes []string
+	for _, name := range orderParameters(parameters) {
+		// This can't fail, since the config has been validated.
+		wanted, _ := formatParameterValue(parameters[name])
+		current, err := s.comm.query(ctx, name)
+		if err != nil {
+			return fmt.Errorf("unable to read drive parameter %s: %w", name, err)
+		}
+		if sameParameterValue(wanted, current) {
+			continue
+		}
+		if err := s.writeParameter(ctx, name, wanted); err != nil {
+			return fmt.Errorf("unable to set drive parameter: %w", err)
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", name, current, wanted))
+	}
+	if len(changes) > 0 {
+		s.logger.Infof("Changed drive parameters to match the config: %s", strings.Join(changes, ", "))
+	} else if len(parameters) > 0 {
+		s.logger.Debug("Drive parameters already match the config")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package st
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/logging"
+)
+
+// replayMotor returns an st that talks to a trace of the given commands and responses.
+func replayMotor(t *testing.T, exchanges [][2]string) *st {
+	logger := logging.NewTestLogger(t)
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	trace, err := openTrace(path)
+	assert.Nil(t, err)
+	for _, exchange := range exchanges {
+		assert.Nil(t, trace.write(exchange[0], exchange[1], nil))
+	}
+	assert.Nil(t, trace.close())
+
+	comm, err := newReplayComm(path, nil, logger)
+	assert.Nil(t, err)
+	s := &st{
+		logger:      logger,
+		comm:        comm,
+		stepsPerRev: 20000,
+		units:       userUnits{gearRatio: 1, unitsPerRev: 1, label: "revolutions"},
+	}
+	s.updateConversion()
+	return s
+}
+
+func TestRestoreParameters(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		{"SK", "%"},
+		{"AC25", "%"},
+		{"AC", "AC=25.000"},
+		{"CC3.5", "%"},
+		{"CC", "CC=2.000"}, // The drive didn't take the new current
+		{"CM", "CM=21"},
+	})
+
+	response, err := s.restoreParameters(ctx, map[string]interface{}{
+		"parameters": map[string]interface{}{"AC": 25.0, "CC": "3.5"},
+		"save":       true,
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, []interface{}{"AC"}, response["restored"])
+	assert.Contains(t, response["failed"], "CC")
+	assert.Equal(t, false, response["saved"], "should not save after a failure")
+	assert.Empty(t, s.comm.handle.(*replay).replayMismatches())
+	assert.Equal(t, modePointToPoint, s.mode)
+
+	_, err = s.restoreParameters(ctx, map[string]interface{}{
+		"parameters": map[string]interface{}{"XX": 1.0},
+	})
+	assert.EqualError(t, err, "unknown parameter XX")
+}
+
+func TestReconcileParameters(t *testing.T) {
+	s := replayMotor(t, [][2]string{
+		{"JS", "JS=1.000"},
+		{"JS5", "%"},
+		{"JS", "JS=5.000"},
+		{"CC", "CC=2.500"}, // Already matches, so it isn't written
+		{"PN", "PN=1"},
+	})
+	err := s.reconcileParameters(context.Background(), map[string]interface{}{
+		"PN": "1", "JS": 5.0, "CC": 2.5,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, s.comm.Close(), "every recorded command should have been sent")
+}
@@ -0,0 +1,228 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrParameterOutOfRange is returned when a parameter value is outside of what the drive accepts.
+var ErrParameterOutOfRange = errors.New("parameter out of range")
+
+type paramUnits int
+
+const (
+	unitsNone         paramUnits = iota
+	unitsAcceleration            // Revolutions/sec^2 on the drive, converted to user units
+	unitsVelocity                // Revolutions/sec on the drive, converted to user units
+	unitsAmps
+	unitsSeconds
+	unitsHz
+	unitsSteps
+)
+
+// paramSpec describes a drive parameter that can be read and set with get_param and set_param.
+// The range is in the drive's own units, from the Host Command Reference.
+type paramSpec struct {
+	name    string
+	scl     string
+	integer bool
+	units   paramUnits
+	min     float64
+	max     float64
+	// Immediate parameters take effect as soon as they are sent. Buffered ones wait in the drive's
+	// queue behind any moves that are already queued.
+	immediate bool
+	// If set, set_param refuses the parameter, and this says how to change it instead. These are
+	// parameters the module keeps its own copy of, which set_param would leave out of date.
+	setWith string
+}
+
+var paramTable = []paramSpec{
+	{name: "acceleration", scl: "AC", units: unitsAcceleration, min: 0.167, max: 5461.167},
+	{name: "deceleration", scl: "DE", units: unitsAcceleration, min: 0.167, max: 5461.167},
+	{name: "stop_deceleration", scl: "AM", units: unitsAcceleration, min: 0.167, max: 5461.167},
+	{name: "velocity", scl: "VE", units: unitsVelocity, min: 0.0042, max: 80},
+	{name: "jog_acceleration", scl: "JA", units: unitsAcceleration, min: 0.167, max: 5461.167, immediate: true},
+	{name: "jog_deceleration", scl: "JL", units: unitsAcceleration, min: 0.167, max: 5461.167, immediate: true},
+	{name: "jog_velocity", scl: "JS", units: unitsVelocity, min: 0.0042, max: 80, immediate: true},
+	{name: "run_current", scl: "CC", units: unitsAmps, min: 0, max: 10, immediate: true},
+	{name: "idle_current", scl: "CI", units: unitsAmps, min: 0, max: 10, immediate: true},
+	{name: "idle_current_delay", scl: "CD", units: unitsSeconds, min: 0, max: 10, immediate: true},
+	{name: "jerk_filter_hz", scl: "KJ", units: unitsHz, min: 0, max: 5000, immediate: true},
+	{name: "steps_per_rev", scl: "EG", integer: true, units: unitsSteps, min: 200, max: 51200, immediate: true,
+		setWith: "set steps_per_rev in the config"},
+	{name: "control_mode", scl: "CM", integer: true, min: 1, max: 22, immediate: true,
+		setWith: "use set_mode"},
+	{name: "power_up_mode", scl: "PM", integer: true, min: 0, max: 10, immediate: true},
+	{name: "limit_switches", scl: "DL", integer: true, min: 1, max: 3, immediate: true},
+}
+
+// lookupParam finds a parameter by its name (such as "acceleration") or its SCL command (such
+// as "AC").
+func lookupParam(name string) (*paramSpec, bool) {
+	for i := range paramTable {
+		if paramTable[i].name == name || paramTable[i].scl == strings.ToUpper(name) {
+			return &paramTable[i], true
+		}
+	}
+	return nil, false
+}
+
+func paramNames() []string {
+	var names []string
+	for _, p := range paramTable {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+// parse converts the drive's text for this parameter into a number, in the drive's units.
+func (p *paramSpec) parse(text string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse %s value %#v: %w", p.scl, text, err)
+	}
+	return value, nil
+}
+
+// driveUnits are the drive's own units, for reporting values that didn't come from the user.
+var driveUnits = userUnits{gearRatio: 1, unitsPerRev: 1, label: "revolutions"}
+
+// check returns an error if the value, in the drive's units, is one the drive wouldn't accept.
+func (p *paramSpec) check(value float64) error {
+	return p.checkIn(driveUnits, value)
+}
+
+// checkIn is like check, but reports the value and the range in the units u.
+func (p *paramSpec) checkIn(u userUnits, value float64) error {
+	if p.integer && value != math.Trunc(value) {
+		return fmt.Errorf("%s (%s) must be an integer, got %v", p.name, p.scl, p.toUser(u, value))
+	}
+	if math.IsNaN(value) || value < p.min || value > p.max {
+		label := ""
+		if l := p.unitLabel(u); l != "" {
+			label = " " + l
+		}
+		// %.10g hides the rounding error from converting the range into user units.
+		return fmt.Errorf("%w: %s (%s) must be between %.10g and %.10g%s, got %.10g",
+			ErrParameterOutOfRange, p.name, p.scl, p.toUser(u, p.min), p.toUser(u, p.max), label,
+			p.toUser(u, value))
+	}
+	return nil
+}
+
+// format returns the text to send to the drive for a value in the drive's units.
+func (p *paramSpec) format(value float64) string {
+	if p.integer {
+		return strconv.FormatInt(int64(value), 10)
+	}
+	// Many commands can only handle 3 digits of precision, like in comms.store.
+	return fmt.Sprintf("%.4f", value)
+}
+
+// toUser converts a value in the drive's units into the user's units.
+func (p *paramSpec) toUser(u userUnits, value float64) float64 {
+	if p.units == unitsAcceleration || p.units == unitsVelocity {
+		return u.fromMotorRevs(value)
+	}
+	return value
+}
+
+// fromUser converts a value in the user's units into the drive's units.
+func (p *paramSpec) fromUser(u userUnits, value float64) float64 {
+	if p.units == unitsAcceleration || p.units == unitsVelocity {
+		return u.toMotorRevs(value)
+	}
+	return value
+}
+
+func (p *paramSpec) unitLabel(u userUnits) string {
+	switch p.units {
+	case unitsAcceleration:
+		return u.label + "/sec^2"
+	case unitsVelocity:
+		return u.label + "/sec"
+	case unitsAmps:
+		return "amps"
+	case unitsSeconds:
+		return "seconds"
+	case unitsHz:
+		return "hz"
+	case unitsSteps:
+		return "steps"
+	default:
+		return ""
+	}
+}
+
+// checkParameterText checks the text for a parameter against the table, if it's in there. It's
+// used for parameters that are set without going through set_param, like drive_parameters.
+func checkParameterText(scl, text string) error {
+	p, ok := lookupParam(scl)
+	if !ok {
+		return nil
+	}
+	value, err := p.parse(text)
+	if err != nil {
+		return err
+	}
+	return p.check(value)
+}
+
+// readParam reads a parameter from the drive, in the drive's units.
+func readParam(ctx context.Context, comm commPort, p *paramSpec) (float64, error) {
+	text, err := comm.query(ctx, p.scl)
+	if err != nil {
+		return 0, err
+	}
+	return p.parse(text)
+}
+
+func (s *st) paramResponse(p *paramSpec, value float64) map[string]interface{} {
+	return map[string]interface{}{
+		"name":      p.name,
+		"scl":       p.scl,
+		"value":     p.toUser(s.units, value),
+		"units":     p.unitLabel(s.units),
+		"immediate": p.immediate,
+	}
+}
+
+// getParam reads a parameter and returns it converted to user units.
+func (s *st) getParam(ctx context.Context, name string) (map[string]interface{}, error) {
+	p, ok := lookupParam(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown parameter %#v, use one of %s, or the raw command",
+			name, strings.Join(paramNames(), ", "))
+	}
+	value, err := readParam(ctx, s.comm, p)
+	if err != nil {
+		return nil, err
+	}
+	return s.paramResponse(p, value), nil
+}
+
+// setParam sets a parameter given in user units. Values out of range are refused without sending
+// anything to the drive.
+func (s *st) setParam(ctx context.Context, name string, userValue float64) (map[string]interface{}, error) {
+	p, ok := lookupParam(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown parameter %#v, use one of %s, or the raw command",
+			name, strings.Join(paramNames(), ", "))
+	}
+	if p.setWith != "" {
+		return nil, fmt.Errorf("%s can't be set with set_param, %s instead", p.name, p.setWith)
+	}
+	value := p.fromUser(s.units, userValue)
+	if err := p.checkIn(s.units, value); err != nil {
+		return nil, err
+	}
+	if err := s.writeParameter(ctx, p.scl, p.format(value)); err != nil {
+		return nil, err
+	}
+	return s.paramResponse(p, value), nil
+}
@@ -0,0 +1,249 @@
+package st
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// How long Close waits for the motor to stop before giving up on saving its position.
+const closeSettleTimeout = 2 * time.Second
+
+// ErrUnhomed is returned for motion commands while the axis's position can't be trusted.
+var ErrUnhomed = errors.New("the axis is unhomed, home it or send acknowledge_position first")
+
+// savedPosition is what we write to the position file. Steps is the drive's own count (IP), which
+// is what tells us whether the drive has lost its position since.
+type savedPosition struct {
+	Steps      int64     `json:"steps"`
+	Position   float64   `json:"position"`
+	ZeroOffset float64   `json:"zero_offset"`
+	Direction  int       `json:"backlash_direction,omitempty"`
+	Updated    time.Time `json:"updated"`
+}
+
+// positionFile keeps the last known position on disk, so that a restart of the module or the
+// drive doesn't silently lose our zero on an axis without an encoder.
+type positionFile struct {
+	path string
+
+	mu   sync.Mutex
+	last savedPosition
+	// Whether last was read from the file, rather than being the zero value.
+	loaded bool
+	// Why the axis is unhomed, or "" if it isn't.
+	unhomed string
+}
+
+func loadPositionFile(path string) (*positionFile, error) {
+	f := &positionFile{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read position file: %w", err)
+	}
+	if err := json.Unmarshal(data, &f.last); err != nil {
+		return nil, fmt.Errorf("unable to parse position file %s: %w", path, err)
+	}
+	f.loaded = true
+	return f, nil
+}
+
+// write saves the position, replacing the file in one step so that a crash partway through
+// doesn't leave it truncated. The caller must hold the file's mutex.
+func (f *positionFile) write(pos savedPosition) error {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+	f.last = pos
+	f.loaded = true
+	return nil
+}
+
+// startPositionFile loads the position file, and checks it against the drive's step count. If
+// they don't match, the drive has been restarted or moved without us, so we mark the axis unhomed.
+func (s *st) startPositionFile(ctx context.Context, path string) error {
+	var f *positionFile
+	if path != "" {
+		var err error
+		if f, err = loadPositionFile(path); err != nil {
+			return err
+		}
+	}
+	s.sharedMu.Lock()
+	s.positions = f
+	s.sharedMu.Unlock()
+	if f == nil {
+		return nil
+	}
+	steps, err := s.readSteps(ctx)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case !f.loaded:
+		s.logger.Infof("No saved position in %s yet, starting from the drive's position", path)
+	case int32(f.last.Steps) != int32(steps):
+		f.unhomed = fmt.Sprintf("the drive is at step %d, but it was at step %d when the module "+
+			"last saved its position at %s", steps, f.last.Steps, f.last.Updated.Format(time.RFC3339))
+		s.logger.Warnf("Marking the axis unhomed: %s", f.unhomed)
+		return nil
+	default:
+		// The drive only has the low 32 bits of the count, so take the rest from the file.
+		steps = f.last.Steps
+		s.counter.set(int32(steps), steps)
+		s.setDirection(f.last.Direction)
+		s.logger.Debugf("The drive's position matches the one saved in %s", path)
+	}
+	return s.writePosition(steps, f.last.ZeroOffset)
+}
+
+// writePosition saves the given step count as the current position. The caller must hold the
+// file's mutex.
+func (s *st) writePosition(steps int64, zeroOffset float64) error {
+	return s.positions.write(savedPosition{
+		Steps:      steps,
+		Position:   s.conversion().position(steps),
+		ZeroOffset: zeroOffset,
+		Direction:  s.backlash.direction,
+		Updated:    time.Now(),
+	})
+}
+
+// savePosition saves the current position, e.g. after a move. While the axis is unhomed, the file
+// keeps the last trusted position instead, so that acknowledge_position can restore it. Failures
+// are logged rather than returned, since they shouldn't fail the move itself.
+func (s *st) savePosition(ctx context.Context) {
+	if s.positions == nil {
+		return
+	}
+	s.positions.mu.Lock()
+	defer s.positions.mu.Unlock()
+	if s.positions.unhomed != "" {
+		return
+	}
+	steps, err := s.readSteps(ctx)
+	if err == nil {
+		err = s.writePosition(steps, s.positions.last.ZeroOffset)
+	}
+	if err != nil {
+		s.logger.Errorf("Unable to save the position to %s: %v", s.positions.path, err)
+	}
+}
+
+// zeroed records a new zero from ResetZeroPosition or homing, which also makes the axis homed
+// again.
+func (s *st) zeroed(ctx context.Context, offset float64) {
+	if s.positions == nil {
+		return
+	}
+	s.positions.mu.Lock()
+	if s.positions.unhomed != "" {
+		s.logger.Info("The axis has a new zero, it is no longer unhomed")
+	}
+	s.positions.unhomed = ""
+	s.positions.last.ZeroOffset = offset
+	s.positions.mu.Unlock()
+	s.savePosition(ctx)
+}
+
+// checkHomed returns ErrUnhomed if the position file didn't match the drive.
+func (s *st) checkHomed() error {
+	if s.positions == nil {
+		return nil
+	}
+	s.positions.mu.Lock()
+	defer s.positions.mu.Unlock()
+	if s.positions.unhomed != "" {
+		return fmt.Errorf("%w: %s", ErrUnhomed, s.positions.unhomed)
+	}
+	return nil
+}
+
+// acknowledgePosition clears the unhomed state without homing. By default the drive's current
+// position is accepted as it is. With restore, the drive is set back to the saved step count, for
+// when we know the axis hasn't moved since, e.g. after the drive lost power.
+func (s *st) acknowledgePosition(ctx context.Context, restore bool) (map[string]interface{}, error) {
+	if s.positions == nil {
+		return nil, errors.New("no position_file is configured")
+	}
+	s.positions.mu.Lock()
+	if restore {
+		if !s.positions.loaded {
+			s.positions.mu.Unlock()
+			return nil, errors.New("there is no saved position to restore")
+		}
+		if err := s.setSteps(ctx, s.positions.last.Steps); err != nil {
+			s.positions.mu.Unlock()
+			return nil, err
+		}
+		s.setDirection(s.positions.last.Direction)
+	}
+	s.positions.unhomed = ""
+	s.positions.mu.Unlock()
+	s.logger.Infof("Position acknowledged (restore=%v), the axis is no longer unhomed", restore)
+	s.savePosition(ctx)
+	return s.positionFileStatus(), nil
+}
+
+// positionFileStatus describes the position file for DoCommands.
+func (s *st) positionFileStatus() map[string]interface{} {
+	f := s.shared().positions
+	if f == nil {
+		return map[string]interface{}{"configured": false}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result := map[string]interface{}{
+		"configured": true,
+		"homed":      f.unhomed == "",
+	}
+	if f.unhomed != "" {
+		result["reason"] = f.unhomed
+	}
+	if f.loaded {
+		result["saved_position"] = f.last.Position
+		result["saved_steps"] = float64(f.last.Steps)
+		result["zero_offset"] = f.last.ZeroOffset
+		result["updated"] = f.last.Updated.Format(time.RFC3339Nano)
+	}
+	return result
+}
+
+// saveFinalPosition waits for the motor to come to a stop, e.g. from a jog, and then saves its
+// position, before the connection to the drive closes.
+func (s *st) saveFinalPosition(ctx context.Context) {
+	if s.positions == nil {
+		return
+	}
+	if err := s.waitForMoveCommandToComplete(ctx, closeSettleTimeout); err != nil {
+		s.logger.Warnf("Not saving the position, the motor didn't come to a stop: %v", err)
+		return
+	}
+	s.savePosition(ctx)
+}
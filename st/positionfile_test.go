@@ -0,0 +1,53 @@
+package st
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPositionFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "position.json")
+
+	// The first start has nothing to compare against.
+	s := replayMotor(t, [][2]string{
+		{"IP", "IP=00004E20"},
+		{"EP0", "%"},
+		{"SP0", "%"},
+		{"IP", "IP=00000000"},
+		{"IP", "IP=00004E20"},
+	})
+	assert.Nil(t, s.startPositionFile(ctx, path))
+	assert.Nil(t, s.checkHomed())
+	assert.Nil(t, s.resetZeroPosition(ctx, 0))
+	s.savePosition(ctx)
+	assert.Nil(t, s.comm.Close())
+	assert.Equal(t, 1.0, s.positionFileStatus()["saved_position"])
+
+	// After a module restart, the drive still has the same count.
+	s = replayMotor(t, [][2]string{{"IP", "IP=00004E20"}})
+	assert.Nil(t, s.startPositionFile(ctx, path))
+	assert.Nil(t, s.checkHomed())
+	assert.Nil(t, s.comm.Close())
+
+	// After a drive restart, it doesn't. Nothing is saved until the position is acknowledged.
+	s = replayMotor(t, [][2]string{
+		{"IP", "IP=00000000"},
+		{"EP20000", "%"},
+		{"SP20000", "%"},
+		{"IP", "IP=00004E20"},
+	})
+	assert.Nil(t, s.startPositionFile(ctx, path))
+	assert.ErrorIs(t, s.checkHomed(), ErrUnhomed)
+	assert.Equal(t, false, s.positionFileStatus()["homed"])
+	_, err := s.DoCommand(ctx, map[string]interface{}{"command": "raw", "scl": "FL100"})
+	assert.ErrorIs(t, err, ErrUnhomed)
+	s.savePosition(ctx)
+	_, err = s.acknowledgePosition(ctx, true)
+	assert.Nil(t, err)
+	assert.Nil(t, s.checkHomed())
+	assert.Nil(t, s.comm.Close())
+}
@@ -0,0 +1,189 @@
+package st
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+// replayConfig returns a config that replays the given exchanges instead of talking to a drive.
+func replayConfig(t *testing.T, exchanges [][2]string) resource.Config {
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	trace, err := openTrace(path)
+	assert.Nil(t, err)
+	for _, exchange := range exchanges {
+		assert.Nil(t, trace.write(exchange[0], exchange[1], nil))
+	}
+	assert.Nil(t, trace.close())
+	return resource.Config{
+		Name:  "motor",
+		API:   motor.API,
+		Model: Model,
+		ConvertedAttributes: &Config{
+			Protocol: "replay", Uri: path, StepsPerRev: 20000, MaxRpm: 600,
+		},
+	}
+}
+
+// replayed returns how many entries of the trace have been sent so far.
+func replayed(s *st) int {
+	r := s.comm.handle.(*replay)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.next
+}
+
+func TestReconfigureMidMove(t *testing.T) {
+	ctx := context.Background()
+	conf := replayConfig(t, [][2]string{
+		{"MV", "MV=107A066"},
+		{"RV", "RV=5"},
+		{"CM", "CM=21"},
+		// GoFor
+		{"SK", "%"},
+		{"AC", "AC=25"},
+		{"DE", "DE=25"},
+		{"DI20000", "%"},
+		{"VE1.0000", "%"},
+		{"FL", "%"},
+		// The units change, so Reconfigure stops the move, and keeps the connection.
+		{"SK", "%"},
+		{"CM", "CM=21"},
+		// Close
+		{"SK", "%"},
+	})
+	m, err := newMotor(ctx, nil, conf, logging.NewTestLogger(t))
+	assert.Nil(t, err)
+	s := m.(*st)
+	comm := s.comm
+
+	moveErr := make(chan error)
+	go func() { moveErr <- s.GoFor(ctx, 60, 1, nil) }()
+	assert.Eventually(t, func() bool { return replayed(s) == 9 }, time.Second, time.Millisecond)
+
+	conf.ConvertedAttributes.(*Config).GearRatio = 2
+	assert.Nil(t, s.Reconfigure(ctx, nil, conf))
+	assert.ErrorIs(t, <-moveErr, context.Canceled)
+	assert.Equal(t, comm, s.comm, "the connection should have been kept")
+	assert.Nil(t, s.Close(ctx), "every command should have been replayed")
+}
+
+func TestReconfigureKeepsMove(t *testing.T) {
+	ctx := context.Background()
+	conf := replayConfig(t, [][2]string{
+		{"MV", "MV=107A066"},
+		{"RV", "RV=5"},
+		{"CM", "CM=21"},
+		// GoFor
+		{"SK", "%"},
+		{"AC", "AC=25"},
+		{"DE", "DE=25"},
+		{"DI20000", "%"},
+		{"VE1.0000", "%"},
+		{"FL", "%"},
+		{"BS", "BS=63"},
+		{"SC", "SC=0009"},
+		// Only max_rpm changes, so Reconfigure waits for the move to finish.
+		{"CM", "CM=21"},
+		// Close
+		{"SK", "%"},
+	})
+	m, err := newMotor(ctx, nil, conf, logging.NewTestLogger(t))
+	assert.Nil(t, err)
+	s := m.(*st)
+
+	moveErr := make(chan error)
+	go func() { moveErr <- s.GoFor(ctx, 60, 1, nil) }()
+	assert.Eventually(t, func() bool { return replayed(s) == 9 }, time.Second, time.Millisecond)
+
+	conf.ConvertedAttributes.(*Config).MaxRpm = 300
+	assert.Nil(t, s.Reconfigure(ctx, nil, conf))
+	assert.Nil(t, <-moveErr)
+	assert.Equal(t, 300.0, s.rpmLimits.max)
+	assert.Nil(t, s.Close(ctx), "every command should have been replayed")
+}
+
+func TestReconfigureKeepsJog(t *testing.T) {
+	ctx := context.Background()
+	conf := replayConfig(t, [][2]string{
+		{"MV", "MV=107A066"},
+		{"RV", "RV=5"},
+		{"CM", "CM=21"},
+		// SetPower
+		{"EG20000", "%"},
+		{"JA0.000000", "%"},
+		{"JL0.000000", "%"},
+		{"CJ", "%"},
+		{"CS5.000000", "%"},
+		// Changing max_rpm leaves the jog running.
+		{"CM", "CM=21"},
+		// Changing steps_per_rev stops it.
+		{"SK", "%"},
+		{"CM", "CM=21"},
+		// Close
+		{"SK", "%"},
+	})
+	m, err := newMotor(ctx, nil, conf, logging.NewTestLogger(t))
+	assert.Nil(t, err)
+	s := m.(*st)
+	assert.Nil(t, s.SetPower(ctx, 0.5, nil))
+
+	attrs := conf.ConvertedAttributes.(*Config)
+	attrs.MaxRpm = 300
+	assert.Nil(t, s.Reconfigure(ctx, nil, conf))
+	assert.NotNil(t, s.tracker, "the jog should still be tracked")
+
+	attrs.StepsPerRev = 10000
+	assert.Nil(t, s.Reconfigure(ctx, nil, conf))
+	assert.Nil(t, s.tracker)
+	assert.Nil(t, s.Close(ctx), "every command should have been replayed")
+}
+
+func TestReconfigureWithoutConnection(t *testing.T) {
+	ctx := context.Background()
+	conf := replayConfig(t, [][2]string{{"SK", "%"}})
+	s := replayMotor(t, nil)
+	s.metrics = newMetrics()
+
+	// The trace doesn't exist, so we can't connect. Nothing should try to use the old connection.
+	conf.ConvertedAttributes.(*Config).Uri = filepath.Join(t.TempDir(), "missing.jsonl")
+	assert.NotNil(t, s.Reconfigure(ctx, nil, conf))
+	assert.Nil(t, s.comm)
+	assert.ErrorIs(t, s.Stop(ctx, nil), ErrNotConnected)
+	assert.ErrorIs(t, s.GoFor(ctx, 60, 1, nil), ErrNotConnected)
+	assert.Nil(t, s.Close(ctx))
+}
+
+func TestReconfigureJerkFilter(t *testing.T) {
+	ctx := context.Background()
+	conf := replayConfig(t, [][2]string{
+		{"MV", "MV=107A066"},
+		{"RV", "RV=5"},
+		{"CM", "CM=21"},
+		{"KJ50.0000", "%"},
+		// The filter is changed, and then removed from the config, which turns it off.
+		{"CM", "CM=21"},
+		{"KJ20.0000", "%"},
+		{"CM", "CM=21"},
+		{"KJ0", "%"},
+		// Close
+		{"SK", "%"},
+	})
+	attrs := conf.ConvertedAttributes.(*Config)
+	attrs.JerkFilter = 50
+	m, err := newMotor(ctx, nil, conf, logging.NewTestLogger(t))
+	assert.Nil(t, err)
+	s := m.(*st)
+
+	attrs.JerkFilter = 20
+	assert.Nil(t, s.Reconfigure(ctx, nil, conf))
+	attrs.JerkFilter = 0
+	assert.Nil(t, s.Reconfigure(ctx, nil, conf))
+	assert.Nil(t, s.Close(ctx), "every command should have been replayed")
+}
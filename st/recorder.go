@@ -0,0 +1,306 @@
+package st
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.viam.com/utils"
+)
+
+const (
+	defaultRecordingRate     = 20.0
+	maxRecordingRate         = 100.0
+	defaultRecordingCapacity = 10000
+	// An hour at the maximum rate, which is a few tens of megabytes. The whole buffer is allocated
+	// up front, so this keeps a typo from taking down the module.
+	maxRecordingCapacity = 360000
+)
+
+// sample is one row of a recording. Positions are in user units, velocity is in user units per
+// minute, and current is in amps.
+type sample struct {
+	Time              time.Time `json:"time"`
+	Position          float64   `json:"position"`
+	CommandedPosition float64   `json:"commanded_position"`
+	Velocity          float64   `json:"velocity"`
+	Current           float64   `json:"current"`
+	Status            uint16    `json:"status"`
+}
+
+// recorder samples the drive at a fixed rate into a ring buffer, so that the most recent
+// capacity samples are always available. It talks to the drive through the comm port directly
+// rather than through the st mutex, so it can keep running during moves.
+type recorder struct {
+	mu       sync.Mutex
+	samples  []sample
+	next     int // Where the next sample goes in samples
+	full     bool
+	errors   int
+	lastErr  error
+	cancel   func()
+	finished chan struct{}
+}
+
+func newRecorder(capacity int) *recorder {
+	return &recorder{samples: make([]sample, capacity)}
+}
+
+// start samples at rateHz until stop is called.
+func (r *recorder) start(rateHz float64, read func(context.Context) (sample, error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.finished = make(chan struct{})
+	utils.PanicCapturingGo(func() {
+		defer close(r.finished)
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rateHz))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			s, err := read(ctx)
+			r.add(s, err)
+		}
+	})
+}
+
+func (r *recorder) add(s sample, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.errors++
+		r.lastErr = err
+		return
+	}
+	r.samples[r.next] = s
+	r.next++
+	if r.next == len(r.samples) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// stop stops sampling and waits for the last sample to finish. The samples are kept.
+func (r *recorder) stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.finished
+	r.cancel = nil
+}
+
+func (r *recorder) running() bool {
+	return r.cancel != nil
+}
+
+// contents returns the samples in the order they were taken.
+func (r *recorder) contents() []sample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]sample{}, r.samples[:r.next]...)
+	}
+	return append(append([]sample{}, r.samples[r.next:]...), r.samples[:r.next]...)
+}
+
+func (r *recorder) csv() (string, error) {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	rows := [][]string{{"time", "position", "commanded_position", "velocity", "current", "status"}}
+	for _, s := range r.contents() {
+		rows = append(rows, []string{
+			s.Time.Format(time.RFC3339Nano),
+			strconv.FormatFloat(s.Position, 'f', -1, 64),
+			strconv.FormatFloat(s.CommandedPosition, 'f', -1, 64),
+			strconv.FormatFloat(s.Velocity, 'f', -1, 64),
+			strconv.FormatFloat(s.Current, 'f', -1, 64),
+			fmt.Sprintf("%04x", s.Status),
+		})
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// readImmediate sends one of the "immediate" commands (IP, IE, IV, IC, ...) and returns its value.
+// These come back as hex and are signed, so we need to know how many bits wide the value is to
+// get the sign right.
+func (s *st) readImmediate(ctx context.Context, command string, bits int) (int64, error) {
+	return queryImmediate(ctx, s.comm, command, bits)
+}
+
+// queryImmediate is readImmediate with the given comm, for code that doesn't hold the mutex.
+func queryImmediate(ctx context.Context, comm commPort, command string, bits int) (int64, error) {
+	resp, err := comm.query(ctx, command)
+	if err != nil {
+		return 0, err
+	}
+	// We parse the value as though it was unsigned, but it's really signed. We can't parse it as
+	// signed originally because strconv expects the sign to be indicated by a "-" at the
+	// beginning, not by the most significant bit in the word. Convert it here.
+	val, err := strconv.ParseUint(strings.TrimSpace(resp), 16, bits)
+	if err != nil {
+		return 0, err
+	}
+	if bits == 16 {
+		return int64(int16(val)), nil
+	}
+	return int64(int32(val)), nil
+}
+
+// readSample reads everything in a sample from the drive. IP is where the drive has commanded the
+// motor to be, and IE is where the encoder says it is (which is 0 without an encoder).
+func (s *st) readSample(ctx context.Context) (sample, error) {
+	result := sample{Time: time.Now()}
+	// The recorder runs without the mutex, so it uses shared() and the published copy of the
+	// conversion.
+	comm := s.shared().comm
+	conv := s.conversion()
+
+	commanded, err := s.readStepsWith(ctx, comm)
+	if err != nil {
+		return result, err
+	}
+	result.CommandedPosition = conv.position(commanded)
+
+	encoder, err := queryImmediate(ctx, comm, "IE", 32)
+	if err != nil {
+		return result, err
+	}
+	result.Position = conv.position(encoder)
+
+	// IV0 is the actual velocity in RPM, and IC is the commanded current in hundredths of an amp.
+	velocity, err := queryImmediate(ctx, comm, "IV0", 16)
+	if err != nil {
+		return result, err
+	}
+	result.Velocity = conv.units.fromMotorRevs(float64(velocity))
+
+	current, err := queryImmediate(ctx, comm, "IC", 16)
+	if err != nil {
+		return result, err
+	}
+	result.Current = float64(current) / 100
+
+	status, err := readStatus(ctx, comm)
+	if err != nil {
+		return result, err
+	}
+	result.Status = uint16(status[0])<<8 | uint16(status[1])
+	return result, nil
+}
+
+// The recording verbs don't need the st mutex, so they work while a move is in progress.
+
+func (s *st) doStartRecording(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	s.recordingMu.Lock()
+	defer s.recordingMu.Unlock()
+
+	rate, err := extraFloat(args, "rate_hz")
+	if err != nil {
+		return nil, err
+	}
+	if rate == 0 {
+		rate = defaultRecordingRate
+	}
+	if rate < 0 || rate > maxRecordingRate {
+		return nil, fmt.Errorf("rate_hz must be between 0 and %v", maxRecordingRate)
+	}
+	capacity, err := extraFloat(args, "capacity")
+	if err != nil {
+		return nil, err
+	}
+	if capacity == 0 {
+		capacity = defaultRecordingCapacity
+	}
+	if capacity < 1 || capacity > maxRecordingCapacity {
+		return nil, fmt.Errorf("capacity must be between 1 and %d", maxRecordingCapacity)
+	}
+
+	if s.recording != nil {
+		s.recording.stop()
+	}
+	s.recording = newRecorder(int(capacity))
+	s.recording.start(rate, s.readSample)
+	return map[string]interface{}{"rate_hz": rate, "capacity": int(capacity)}, nil
+}
+
+func (s *st) doStopRecording(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	s.recordingMu.Lock()
+	defer s.recordingMu.Unlock()
+
+	if s.recording == nil {
+		return nil, errors.New("no recording has been started")
+	}
+	s.recording.stop()
+	return map[string]interface{}{"samples": len(s.recording.contents())}, nil
+}
+
+func (s *st) doGetRecording(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+	s.recordingMu.Lock()
+	defer s.recordingMu.Unlock()
+
+	if s.recording == nil {
+		return nil, errors.New("no recording has been started")
+	}
+	s.recording.mu.Lock()
+	response := map[string]interface{}{
+		"recording": s.recording.running(),
+		"errors":    s.recording.errors,
+	}
+	if s.recording.lastErr != nil {
+		response["last_error"] = s.recording.lastErr.Error()
+	}
+	s.recording.mu.Unlock()
+
+	format, err := stringArg(args, "format", false)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "csv":
+		csv, err := s.recording.csv()
+		if err != nil {
+			return nil, err
+		}
+		response["csv"] = csv
+		return response, nil
+	case "", "json":
+	default:
+		return nil, fmt.Errorf("format must be \"csv\" or \"json\", got %#v", format)
+	}
+
+	// Go through JSON-friendly types, since the response has to become a protobuf Struct.
+	var samples []interface{}
+	for _, sample := range s.recording.contents() {
+		samples = append(samples, map[string]interface{}{
+			"time":               sample.Time.Format(time.RFC3339Nano),
+			"position":           sample.Position,
+			"commanded_position": sample.CommandedPosition,
+			"velocity":           sample.Velocity,
+			"current":            sample.Current,
+			"status":             float64(sample.Status),
+		})
+	}
+	response["samples"] = samples
+	return response, nil
+}
+
+// stopRecording stops any recording in progress, e.g. because the comm port is about to change.
+func (s *st) stopRecording() {
+	s.recordingMu.Lock()
+	defer s.recordingMu.Unlock()
+	if s.recording != nil {
+		s.recording.stop()
+	}
+}
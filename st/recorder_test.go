@@ -0,0 +1,66 @@
+package st
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorderRingBuffer(t *testing.T) {
+	r := newRecorder(3)
+	for i := 0; i < 5; i++ {
+		r.add(sample{Position: float64(i)}, nil)
+	}
+	r.add(sample{}, assert.AnError)
+
+	var positions []float64
+	for _, s := range r.contents() {
+		positions = append(positions, s.Position)
+	}
+	assert.Equal(t, []float64{2, 3, 4}, positions, "should keep the newest samples, oldest first")
+	assert.Equal(t, 1, r.errors)
+
+	r = newRecorder(3)
+	r.add(sample{Time: time.Unix(0, 0).UTC(), Position: 1.5, Status: 0x0019}, nil)
+	csv, err := r.csv()
+	assert.Nil(t, err)
+	assert.Equal(t, "time,position,commanded_position,velocity,current,status\n"+
+		"1970-01-01T00:00:00Z,1.5,0,0,0,0019\n", csv)
+}
+
+func TestRecorderSample(t *testing.T) {
+	s := replayMotor(t, [][2]string{
+		{"IP", "IP=00004E20"},
+		{"IE", "IE=00000000"},
+		{"IV0", "IV=003C"},
+		{"IC", "IC=00C8"},
+		{"SC", "SC=0019"},
+	})
+	s.backlash.amount = 10000
+	s.setDirection(-1)
+
+	result, err := s.readSample(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, result.CommandedPosition, "should include the backlash offset")
+	assert.Equal(t, 0.5, result.Position)
+	assert.Equal(t, 60.0, result.Velocity)
+	assert.Equal(t, 2.0, result.Current)
+	assert.Equal(t, uint16(0x0019), result.Status)
+	assert.Nil(t, s.comm.Close())
+}
+
+func TestRecordingCapacity(t *testing.T) {
+	s := replayMotor(t, nil)
+
+	// The buffer is allocated up front, so a huge capacity is refused rather than tried.
+	for _, capacity := range []float64{1e12, maxRecordingCapacity + 1, 0.5, -1} {
+		_, err := s.DoCommand(context.Background(), map[string]interface{}{
+			"command": "start_recording", "capacity": capacity,
+		})
+		assert.ErrorContains(t, err, "capacity must be between 1 and 360000")
+	}
+	assert.Nil(t, s.recording)
+	assert.Nil(t, s.comm.Close())
+}
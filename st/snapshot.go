@@ -0,0 +1,183 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/data"
+	"go.viam.com/utils"
+)
+
+// snapshot is the drive's state as of the last time the background poller read it.
+type snapshot struct {
+	time        time.Time
+	status      []byte
+	steps       int64
+	position    float64 // In user units, converted when the steps were read
+	temperature float64 // Degrees C
+	alarm       uint16
+}
+
+// statusPoller reads the drive's state in the background, so that data capture can be served
+// from memory instead of adding traffic on the wire in the middle of a move.
+type statusPoller struct {
+	mu       sync.Mutex
+	interval time.Duration
+	latest   *snapshot
+	lastErr  error
+	cancel   func()
+	finished chan struct{}
+}
+
+func newStatusPoller(interval time.Duration, read func(context.Context) (snapshot, error)) *statusPoller {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &statusPoller{interval: interval, cancel: cancel, finished: make(chan struct{})}
+	utils.PanicCapturingGo(func() {
+		defer close(p.finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			snap, err := read(ctx)
+			p.mu.Lock()
+			if err != nil {
+				p.lastErr = err
+			} else {
+				p.latest = &snap
+				p.lastErr = nil
+			}
+			p.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+	return p
+}
+
+func (p *statusPoller) stop() {
+	p.cancel()
+	<-p.finished
+}
+
+// get returns the latest snapshot, or an error if there isn't one or it's gone stale (e.g.,
+// because the drive stopped answering).
+func (p *statusPoller) get() (snapshot, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.latest == nil {
+		if p.lastErr != nil {
+			return snapshot{}, p.lastErr
+		}
+		return snapshot{}, errors.New("no status has been read yet")
+	}
+	if time.Since(p.latest.time) > 3*p.interval {
+		return snapshot{}, errors.New("status is stale")
+	}
+	return *p.latest, nil
+}
+
+// readSnapshot reads everything in a snapshot from the drive. IT is the drive's temperature in
+// tenths of a degree C, and AL is the alarm code, with one bit per alarm.
+func (s *st) readSnapshot(ctx context.Context) (snapshot, error) {
+	result := snapshot{time: time.Now()}
+	// The poller and the status DoCommand run without the mutex, so they use shared() and the
+	// published copy of the conversion.
+	shared := s.shared()
+	conv := s.conversion()
+	var err error
+	if result.status, err = readStatus(ctx, shared.comm); err != nil {
+		return result, err
+	}
+	// Catch the drive disabling the motor on its own, e.g. on a fault, while nobody is moving it.
+	if err := shared.brake.engageIfDisabled(ctx, shared.comm, result.status, s.logger); err != nil {
+		s.logger.Errorf("Unable to engage the brake: %v", err)
+	}
+	if result.steps, err = s.readStepsWith(ctx, shared.comm); err != nil {
+		return result, err
+	}
+	result.position = conv.position(result.steps)
+	temperature, err := queryImmediate(ctx, shared.comm, "IT", 16)
+	if err != nil {
+		return result, err
+	}
+	result.temperature = float64(temperature) / 10
+	alarm, err := shared.comm.query(ctx, "AL")
+	if err != nil {
+		return result, err
+	}
+	alarmCode, err := strconv.ParseUint(strings.TrimSpace(alarm), 16, 16)
+	if err != nil {
+		return result, err
+	}
+	result.alarm = uint16(alarmCode)
+	return result, nil
+}
+
+// fromDataManagement returns whether a call came from the data manager capturing data, rather
+// than from a user.
+func fromDataManagement(extra map[string]interface{}) bool {
+	fromDM, _ := extra[data.FromDMString].(bool)
+	return fromDM
+}
+
+// capturedSnapshot returns the latest snapshot for data capture. If it isn't available, we return
+// data.ErrNoCaptureToStore so that nothing is captured, rather than capturing something wrong.
+func (s *st) capturedSnapshot() (snapshot, error) {
+	s.pollerMu.Lock()
+	poller := s.poller
+	s.pollerMu.Unlock()
+	if poller == nil {
+		s.noPollerWarning.Do(func() {
+			s.logger.Warn("Not capturing data: status_poll_interval_ms must be set to capture data")
+		})
+		return snapshot{}, data.ErrNoCaptureToStore
+	}
+	snap, err := poller.get()
+	if err != nil {
+		s.logger.Debugf("Not capturing data: %v", err)
+		return snapshot{}, data.ErrNoCaptureToStore
+	}
+	return snap, nil
+}
+
+// readings returns the latest snapshot with stable keys, for logging on a schedule.
+func (s *st) readings() (map[string]interface{}, error) {
+	snap, err := s.capturedSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"timestamp":     snap.time.Format(time.RFC3339Nano),
+		"position":      snap.position,
+		"is_powered":    snap.status[1]&1 == 1,
+		"temperature_c": snap.temperature,
+		"alarm_code":    float64(snap.alarm),
+		"status":        float64(uint16(snap.status[0])<<8 | uint16(snap.status[1])),
+	}, nil
+}
+
+// restartPoller stops any poller we have, and starts a new one if interval is nonzero.
+func (s *st) restartPoller(interval time.Duration) {
+	s.stopPoller()
+	if interval > 0 {
+		s.pollerMu.Lock()
+		s.poller = newStatusPoller(interval, s.readSnapshot)
+		s.pollerMu.Unlock()
+	}
+}
+
+func (s *st) stopPoller() {
+	s.pollerMu.Lock()
+	defer s.pollerMu.Unlock()
+	if s.poller != nil {
+		s.poller.stop()
+		s.poller = nil
+	}
+}
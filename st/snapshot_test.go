@@ -0,0 +1,50 @@
+package st
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/data"
+)
+
+func TestCapturedSnapshot(t *testing.T) {
+	ctx := context.Background()
+	captured := map[string]interface{}{data.FromDMString: true}
+	s := replayMotor(t, [][2]string{
+		{"SC", "SC=0009"},
+		{"IP", "IP=00004E20"},
+		{"IT", "IT=0190"},
+		{"AL", "AL=0000"},
+	})
+
+	// Without a poller, there's nothing to capture.
+	_, err := s.Position(ctx, captured)
+	assert.ErrorIs(t, err, data.ErrNoCaptureToStore)
+
+	s.backlash.amount = 10000
+	s.setDirection(-1)
+	s.poller = newStatusPoller(time.Hour, s.readSnapshot)
+	assert.Eventually(t, func() bool {
+		_, err := s.poller.get()
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	// The position was converted when it was read, so later changes don't affect it.
+	s.setDirection(1)
+	position, err := s.Position(ctx, captured)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, position)
+	powered, _, err := s.IsPowered(ctx, captured)
+	assert.Nil(t, err)
+	assert.True(t, powered)
+
+	readings, err := s.readings()
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, readings["position"])
+	assert.Equal(t, 40.0, readings["temperature_c"])
+
+	s.stopPoller()
+	assert.Nil(t, s.comm.Close())
+}
@@ -29,6 +29,24 @@ type st struct {
 	cancelFunc  func()
 	comm        commPort
 	stepsPerRev int64
+	units       userUnits
+	backlash    backlash
+
+	moveTimeoutFactor float64
+
+	recordingMu sync.Mutex
+	recording   *recorder
+
+	pollerMu sync.Mutex
+	poller   *statusPoller
+	// Warns once about data capture without a poller, rather than on every capture.
+	noPollerWarning sync.Once
+
+	trackerMu sync.Mutex
+	tracker   *stepTracker
+
+	metrics       *metrics
+	metricsServer *metricsServer
 
 	accelLimits limits
 	decelLimits limits
@@ -36,6 +54,40 @@ type st struct {
 
 	defaultAccel float64
 	defaultDecel float64
+
+	analog AnalogConfig
+	mode   controlMode
+
+	follower *follower
+
+	homeInput string
+	homeRpm   float64
+
+	drive driveInfo
+
+	connection connectionSettings
+	jerkFilter float64
+
+	estop *estopWatcher
+	brake *brake
+
+	// Reconfigure replaces comm, estop, follower, brake and positions while holding both mu and
+	// sharedMu. Code that runs without mu, such as the e-stop watchers stopping other motors in
+	// their group and the unlocked DoCommands, reads them with shared().
+	sharedMu sync.RWMutex
+
+	conversions conversions
+
+	positions *positionFile
+
+	// The drive's step count, extended to 64 bits. It's kept across reconnects.
+	counter stepCounter
+
+	// Cancels the move in progress, if any, so that Reconfigure doesn't wait for it to finish when
+	// the move depends on something that changed. The settings are what it depends on.
+	moveMu       sync.Mutex
+	moveCancel   context.CancelFunc
+	moveSettings moveSettings
 }
 
 var ErrStatusMessageIncorrectLength = errors.New("status message incorrect length")
@@ -60,6 +112,7 @@ func newMotor(ctx context.Context, deps resource.Dependencies, conf resource.Con
 		cancelCtx:  cancelCtx,
 		cancelFunc: cancelFunc,
 		mu:         sync.RWMutex{},
+		metrics:    newMetrics(),
 	}
 
 	if err := s.Reconfigure(ctx, deps, conf); err != nil {
@@ -68,47 +121,160 @@ func newMotor(ctx context.Context, deps resource.Dependencies, conf resource.Con
 	return &s, nil
 }
 
-func (s *st) Reconfigure(ctx context.Context, _ resource.Dependencies, conf resource.Config) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.logger.Debug("Reconfiguring Applied Motion Products ST Motor Driver")
-
+func (s *st) Reconfigure(ctx context.Context, deps resource.Dependencies, conf resource.Config) error {
 	newConf, err := resource.NativeConfig[*Config](conf)
 	if err != nil {
 		return err
 	}
 
+	// Any move in progress holds the mutex until it's done. If the change doesn't affect it, we
+	// wait for it, but if it was planned in the old units or is running on the old connection,
+	// stop it.
+	settingsChanged, canceled := s.updateMoveSettings(newConf.moveSettings())
+	if canceled {
+		s.logger.Info("Stopping the move in progress to reconfigure")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger.Debug("Reconfiguring Applied Motion Products ST Motor Driver")
+
 	// In case the module has changed name
 	s.Named = conf.ResourceName().AsNamed()
 
 	// Update the steps per rev
 	s.stepsPerRev = newConf.StepsPerRev
+	s.units = newUserUnits(newConf)
 
-	// If we have an old comm object, shut it down. We'll set it up again next paragraph.
-	if s.comm != nil {
-		s.comm.Close()
-		s.comm = nil
-	}
-
-	if comm, err := getComm(s.cancelCtx, newConf, s.logger); err != nil {
+	// Keep the last direction of travel across reconfigures: the gears haven't moved.
+	s.backlash.amount = int64(s.units.toMotorRevs(newConf.Backlash) * float64(s.stepsPerRev))
+	if s.backlash.approach, err = parseApproach(newConf.BacklashApproach); err != nil {
 		return err
-	} else {
+	}
+	s.updateConversion()
+
+	// Reconnecting interrupts any jogging and costs a TCP handshake, so only do it if something
+	// about the connection has changed. Otherwise, shut the old comm object down and set it up
+	// again. Any recording is using it, so stop that first. The e-stop watcher keeps running
+	// until startEStop replaces it, so that the motor is never left unwatched if we fail partway.
+	s.stopPoller()
+	jogging := s.stopStepTracker()
+	if jogging && settingsChanged {
+		// The jog's speed was set in the old steps per revolution, so stop it like a move. If the
+		// old connection is broken, there's nothing more we can do with it.
+		s.logger.Info("Stopping the jog in progress to reconfigure")
+		if _, err := s.comm.send(ctx, "SK"); err != nil {
+			s.logger.Warnf("Unable to stop jogging: %v", err)
+		}
+		jogging = false
+	}
+	connection := newConf.connectionSettings()
+	newComm := s.comm == nil || connection != s.connection
+	if newComm {
+		s.stopRecording()
+		s.sharedMu.Lock()
+		if s.comm != nil {
+			s.comm.Close()
+			s.comm = nil
+			s.metrics.recordReconnect()
+		}
+		comm, err := getComm(s.cancelCtx, newConf, s.metrics, s.logger)
 		s.comm = comm
+		s.sharedMu.Unlock()
+		if err != nil {
+			return err
+		}
+		s.connection = connection
+	} else {
+		s.logger.Debug("Keeping the existing connection to the drive")
 	}
 
 	s.accelLimits = newLimits("acceleration", newConf.MinAcceleration, newConf.MaxAcceleration)
 	s.decelLimits = newLimits("deceleration", newConf.MinDeceleration, newConf.MaxDeceleration)
 	s.rpmLimits = newLimits("rpm", newConf.MinRpm, newConf.MaxRpm)
 
+	if f, err := newFollower(deps, newConf); err != nil {
+		return err
+	} else {
+		s.sharedMu.Lock()
+		s.follower = f
+		s.sharedMu.Unlock()
+	}
+
+	if err := s.startEStop(deps, newConf.EStop); err != nil {
+		return err
+	}
+
+	s.moveTimeoutFactor = newConf.MoveTimeoutFactor
+	if s.moveTimeoutFactor == 0 {
+		s.moveTimeoutFactor = defaultMoveTimeoutFactor
+	}
+
+	s.homeInput = newConf.HomeInput
+	s.homeRpm = newConf.HomeRpm
+
+	s.analog = AnalogConfig{}
+	if newConf.AnalogInput != nil {
+		s.analog = *newConf.AnalogInput
+	}
+
+	// We don't know what the brake output was left at on a new connection, so set it to match the
+	// motor.
+	var newBrake *brake
+	resync := false
+	if newConf.Brake != nil {
+		newBrake = &brake{conf: *newConf.Brake}
+		if !newComm && s.brake != nil && s.brake.conf == *newConf.Brake {
+			newBrake.released = s.brake.released
+		} else {
+			resync = true
+		}
+	}
+	s.sharedMu.Lock()
+	s.brake = newBrake
+	s.sharedMu.Unlock()
+	if resync {
+		if err := s.syncBrake(ctx); err != nil {
+			return err
+		}
+	}
+
+	// The drive's step count only needs checking against the file when we might have missed
+	// something, i.e. on a new connection.
+	if newComm || s.positions == nil || s.positions.path != newConf.PositionFile {
+		if err := s.startPositionFile(ctx, newConf.PositionFile); err != nil {
+			return err
+		}
+	}
+
+	if newComm || newConf.DriveModel != s.drive.configured {
+		s.drive = s.identify(ctx, newConf.DriveModel)
+	}
+
+	if err := s.reconcileParameters(ctx, newConf.DriveParameters); err != nil {
+		return err
+	}
+
+	// Find out where the drive is taking its motion commands from, so we can refuse moves it would
+	// ignore. Not every drive supports reading this back, so a failure here isn't fatal.
+	if mode, err := s.readControlMode(ctx); err != nil {
+		s.logger.Warnf("Unable to read the drive's control mode: %v", err)
+		s.mode = modeUnknown
+	} else {
+		s.mode = mode
+	}
+
+	// If we kept the connection, only send the values that have changed.
+	oldAccel, oldDecel, oldJerkFilter := s.defaultAccel, s.defaultDecel, s.jerkFilter
+
 	s.defaultAccel = newConf.DefaultAcceleration
-	if s.defaultAccel > 0 {
+	if s.defaultAccel > 0 && (newComm || s.defaultAccel != oldAccel) {
 		if err := s.comm.store(ctx, "AC", s.defaultAccel); err != nil {
 			return err
 		}
 	}
 
 	s.defaultDecel = newConf.DefaultDeceleration
-	if s.defaultDecel > 0 {
+	if s.defaultDecel > 0 && (newComm || s.defaultDecel != oldDecel) {
 		if err := s.comm.store(ctx, "DE", s.defaultDecel); err != nil {
 			return err
 		}
@@ -118,10 +284,46 @@ func (s *st) Reconfigure(ctx context.Context, _ resource.Dependencies, conf reso
 		}
 	}
 
+	s.jerkFilter = newConf.JerkFilter
+	if s.jerkFilter > 0 && (newComm || s.jerkFilter != oldJerkFilter) {
+		if err := s.comm.store(ctx, "KJ", s.jerkFilter); err != nil {
+			return err
+		}
+	}
+	// If jerk_filter_hz was removed, turn off the filter we set, so that the drive matches the
+	// config. drive_parameters may take KJ over instead, and it has already been written.
+	_, kjInParameters := newConf.DriveParameters["KJ"]
+	if s.jerkFilter == 0 && oldJerkFilter > 0 && !kjInParameters {
+		if err := s.comm.set(ctx, "KJ", "0"); err != nil {
+			return err
+		}
+	}
+
+	if err := s.updateMetricsServer(newConf.MetricsHost, newConf.MetricsPort); err != nil {
+		return err
+	}
+
+	s.restartPoller(time.Duration(newConf.StatusPollInterval) * time.Millisecond)
+	if jogging && !newComm {
+		s.startStepTracker()
+	}
+
 	return nil
 }
 
-func getComm(ctx context.Context, conf *Config, logger logging.Logger) (commPort, error) {
+func getComm(ctx context.Context, conf *Config, m *metrics, logger logging.Logger) (commPort, error) {
+	comm, err := openComm(ctx, conf, m, logger)
+	if err != nil || conf.TraceFile == "" {
+		return comm, err
+	}
+	if comm.trace, err = openTrace(conf.TraceFile); err != nil {
+		return nil, multierr.Combine(err, comm.Close())
+	}
+	logger.Infof("Tracing drive traffic to %s", conf.TraceFile)
+	return comm, nil
+}
+
+func openComm(ctx context.Context, conf *Config, m *metrics, logger logging.Logger) (commPort, error) {
 	switch {
 	case strings.ToLower(conf.Protocol) == "can":
 		return nil, fmt.Errorf("unsupported comm type %s", conf.Protocol)
@@ -132,30 +334,58 @@ func getComm(ctx context.Context, conf *Config, logger logging.Logger) (commPort
 			conf.ConnectTimeout = 5
 		}
 		timeout := time.Duration(conf.ConnectTimeout * int64(time.Second))
-		return newIpComm(ctx, conf.Uri, timeout, logger)
+		return newIpComm(ctx, conf.Uri, timeout, m, logger)
 	case strings.ToLower(conf.Protocol) == "rs485":
 		logger.Debug("Creating RS485 Comm Port")
-		return newSerialComm(ctx, conf.Uri, logger)
+		return newSerialComm(ctx, conf.Uri, m, logger)
 	case strings.ToLower(conf.Protocol) == "rs232":
 		logger.Debug("Creating RS232 Comm Port")
-		return newSerialComm(ctx, conf.Uri, logger)
+		return newSerialComm(ctx, conf.Uri, m, logger)
+	case strings.ToLower(conf.Protocol) == "replay":
+		logger.Debug("Creating Replay Comm Port")
+		return newReplayComm(conf.Uri, m, logger)
 	default:
 		return nil, fmt.Errorf("unknown comm type %s", conf.Protocol)
 	}
 }
 
+// sharedState is what Reconfigure replaces under sharedMu.
+type sharedState struct {
+	comm      commPort
+	estop     *estopWatcher
+	follower  *follower
+	brake     *brake
+	positions *positionFile
+}
+
+// shared returns the comm, e-stop watcher, follower, brake and position file, for code that
+// doesn't hold the mutex.
+func (s *st) shared() sharedState {
+	s.sharedMu.RLock()
+	defer s.sharedMu.RUnlock()
+	return sharedState{
+		comm: s.comm, estop: s.estop, follower: s.follower, brake: s.brake, positions: s.positions,
+	}
+}
+
 func (s *st) stopMovement(ctx context.Context) error {
 	// The only movement we might be in the middle of is continuous jogging from a SetPower.
 	// Naively, SJ should stop jogging and thus stop continuous movement. However, if you're
 	// jogging, then call SJ, then do a non-jogging movement (e.g., FL) and that movement
 	// completes, it resumes jogging for reasons Alan doesn't understand. The SK command stops and
 	// clears the queue, and then we don't re-commence jogging later.
+	s.stopStepTracker()
 	_, err := s.comm.send(ctx, "SK")
 	return err
 }
 
 func (s *st) getStatus(ctx context.Context) ([]byte, error) {
-	if resp, err := s.comm.send(ctx, "SC"); err != nil {
+	return readStatus(ctx, s.comm)
+}
+
+// readStatus reads the drive's status with the given comm, for code that doesn't hold the mutex.
+func readStatus(ctx context.Context, comm commPort) ([]byte, error) {
+	if resp, err := comm.send(ctx, "SC"); err != nil {
 		return nil, err
 	} else {
 		// TODO: document this better, once you've read the manual.
@@ -214,7 +444,57 @@ func (s *st) getBufferStatus(ctx context.Context) (int, error) {
 	}
 }
 
-func (s *st) waitForMoveCommandToComplete(ctx context.Context) error {
+// startMove makes the move cancelable by Reconfigure. The returned function must be called when
+// the move is done.
+func (s *st) startMove(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	s.moveMu.Lock()
+	defer s.moveMu.Unlock()
+	s.moveCancel = cancel
+	return ctx, func() {
+		s.moveMu.Lock()
+		defer s.moveMu.Unlock()
+		s.moveCancel = nil
+		cancel()
+	}
+}
+
+// updateMoveSettings records the settings that moves from now on depend on. If they've changed, it
+// cancels the move in progress. It returns whether they changed, and whether there was a move to
+// cancel.
+func (s *st) updateMoveSettings(settings moveSettings) (bool, bool) {
+	s.moveMu.Lock()
+	defer s.moveMu.Unlock()
+	if settings == s.moveSettings {
+		return false, false
+	}
+	s.moveSettings = settings
+	if s.moveCancel == nil {
+		return true, false
+	}
+	s.moveCancel()
+	return true, true
+}
+
+// cancelMove cancels the move in progress, and returns whether there was one.
+func (s *st) cancelMove() bool {
+	s.moveMu.Lock()
+	defer s.moveMu.Unlock()
+	if s.moveCancel == nil {
+		return false
+	}
+	s.moveCancel()
+	return true
+}
+
+// waitForMoveCommandToComplete polls the drive until the current move is done. If timeout is
+// nonzero and the move is still going after that long, the motor is stopped and ErrMoveTimeout is
+// returned.
+func (s *st) waitForMoveCommandToComplete(ctx context.Context, timeout time.Duration) error {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
 	for {
 		select {
 		case <-ctx.Done():
@@ -224,6 +504,10 @@ func (s *st) waitForMoveCommandToComplete(ctx context.Context) error {
 			// background context for this.
 			s.Stop(context.Background(), nil)
 			return ctx.Err()
+		case <-deadline:
+			return multierr.Combine(
+				fmt.Errorf("%w: still moving after %v", ErrMoveTimeout, timeout),
+				s.Stop(ctx, nil))
 		case <-time.After(100 * time.Millisecond):
 		}
 		if bufferIsEmpty, err := s.isBufferEmpty(ctx); err != nil {
@@ -246,16 +530,46 @@ func (s *st) isBufferEmpty(ctx context.Context) (bool, error) {
 }
 
 func (s *st) Close(ctx context.Context) error {
+	s.stopRecording()
+	s.stopPoller()
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return multierr.Combine(s.stopMovement(ctx),
-		s.comm.Close())
+	s.stopEStop()
+	if s.estop != nil {
+		s.estop.group.leave(s)
+	}
+	var serverErr error
+	if s.metricsServer != nil {
+		serverErr = s.metricsServer.close()
+		s.metricsServer = nil
+	}
+	if s.comm == nil {
+		// The last Reconfigure couldn't connect, so there is no motor to stop.
+		return serverErr
+	}
+	stopErr := s.stopMovement(ctx)
+	s.saveFinalPosition(ctx)
+	return multierr.Combine(stopErr,
+		s.engageBrake(ctx),
+		s.comm.Close(),
+		serverErr)
 }
 
 func (s *st) GoFor(ctx context.Context, rpm float64, positionRevolutions float64, extra map[string]interface{}) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	ctx, done := s.startMove(ctx)
+	defer done()
 	s.logger.Debugf("GoFor: rpm=%v, positionRevolutions=%v, extra=%v", rpm, positionRevolutions, extra)
+	if err := s.checkEStop(); err != nil {
+		return err
+	}
+	if err := s.checkHomed(); err != nil {
+		return err
+	}
+	if err := s.checkHostMoves(); err != nil {
+		return err
+	}
 
 	// The speed we send to the motor controller must always be positive. If it comes in negative,
 	// flip the distance to travel.
@@ -264,26 +578,71 @@ func (s *st) GoFor(ctx context.Context, rpm float64, positionRevolutions float64
 		positionRevolutions *= -1
 	}
 
-	// Send the configuration commands to setup the motor for the move
-	return s.configuredMove(ctx, "FL", positionRevolutions, rpm, extra)
+	move := func(ctx context.Context) error {
+		// Send the configuration commands to setup the motor for the move
+		return s.configuredMove(ctx, "FL", positionRevolutions, rpm, extra)
+	}
+	if s.follower == nil {
+		return move(ctx)
+	}
+	followerRpm := rpm * math.Abs(s.follower.ratio)
+	followerRevolutions := positionRevolutions * s.follower.ratio
+	followerExtra := s.follower.scaleExtra(extra)
+	return s.mirrorMove(ctx, move, func(ctx context.Context) error {
+		return s.follower.motor.GoFor(ctx, followerRpm, followerRevolutions, followerExtra)
+	})
 }
 
 func (s *st) GoTo(ctx context.Context, rpm float64, positionRevolutions float64, extra map[string]interface{}) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	ctx, done := s.startMove(ctx)
+	defer done()
 	// FP?
 	// For Ethernet drives, do not use FP with a position parameter. Instead, use DI to set the target position.
 	// I guess this means run:
 	// 	DI8000
 	// 	FP
 	s.logger.Debugf("GoTo: rpm=%v, positionRevolutions=%v, extra=%v", rpm, positionRevolutions, extra)
+	if err := s.checkEStop(); err != nil {
+		return err
+	}
+	if err := s.checkHomed(); err != nil {
+		return err
+	}
+	if err := s.checkHostMoves(); err != nil {
+		return err
+	}
+
+	move := func(ctx context.Context) error {
+		// Send the configuration commands to setup the motor for the move
+		return s.configuredMove(ctx, "FP", positionRevolutions, rpm, extra)
+	}
+	if s.follower == nil {
+		return move(ctx)
+	}
+	followerRpm := rpm * math.Abs(s.follower.ratio)
+	followerRevolutions := positionRevolutions * s.follower.ratio
+	followerExtra := s.follower.scaleExtra(extra)
+	return s.mirrorMove(ctx, move, func(ctx context.Context) error {
+		return s.follower.motor.GoTo(ctx, followerRpm, followerRevolutions, followerExtra)
+	})
+}
 
-	// Send the configuration commands to setup the motor for the move
-	return s.configuredMove(ctx, "FP", positionRevolutions, rpm, extra)
+// mirrorMove runs our move and the follower's version of it at the same time, and then checks
+// that the two motors are still in ratio.
+func (s *st) mirrorMove(
+	ctx context.Context, move, followerMove func(context.Context) error,
+) error {
+	if err := s.follower.mirror(ctx, move, followerMove); err != nil {
+		return err
+	}
+	return s.checkDrift(ctx)
 }
 
+// SetRPM implements motor.Motor. The rpm is in user units per minute.
 func (s *st) SetRPM(ctx context.Context, rpm float64, extra map[string]interface{}) error {
-	powerLevel := rpm / s.rpmLimits.max
+	powerLevel := s.units.toMotorRevs(rpm) / s.rpmLimits.max
 	return s.SetPower(ctx, powerLevel, extra)
 }
 
@@ -296,21 +655,38 @@ func (s *st) configuredMove(
 	if err := s.stopMovement(ctx); err != nil {
 		return err
 	}
+	// Record where we ended up, even if the move failed or was canceled partway.
+	defer s.savePosition(context.WithoutCancel(ctx))
 
-	if val, exists := extra["acceleration"]; exists {
-		if valFloat, ok := val.(float64); ok {
-			extra["acceleration"] = s.accelLimits.Bound(valFloat, s.logger)
-		}
+	// A velocity override is the speed of this move, in user units per second like the other
+	// overrides, instead of the rpm we were given. setOverrides puts the old VE back afterwards.
+	velocity, err := extraFloat(extra, "velocity")
+	if err != nil {
+		return err
 	}
-	if val, exists := extra["deceleration"]; exists {
-		if valFloat, ok := val.(float64); ok {
-			extra["deceleration"] = s.decelLimits.Bound(valFloat, s.logger)
+	if velocity > 0 {
+		rpm = velocity * 60
+	}
+
+	// Everything we're given is in user units, but the limits and the drive work in motor
+	// revolutions. Convert everything before going any further. setOverrides converts the extra
+	// values itself.
+	positionRevolutions = s.units.toMotorRevs(positionRevolutions)
+	rpm = s.units.toMotorRevs(rpm)
+	if strictLimits(extra) {
+		if err := s.rpmLimits.Check(rpm); err != nil {
+			return err
 		}
 	}
 
-	oldAcceleration, err := setOverrides(ctx, s.comm, extra)
+	// Whatever happens from here on, put back any overrides that were set.
+	saved, err := s.setOverrides(ctx, extra)
 	if err != nil {
-		return err
+		return multierr.Combine(err, saved.restore(ctx, s.comm))
+	}
+
+	if err := s.releaseBrake(ctx); err != nil {
+		return multierr.Combine(err, saved.restore(ctx, s.comm))
 	}
 
 	rpm = s.rpmLimits.Bound(rpm, s.logger)
@@ -318,7 +694,73 @@ func (s *st) configuredMove(
 	// need to convert from RPM to revs per second
 	revSec := rpm / 60
 	// need to convert from revs to steps
-	positionSteps := int64(positionRevolutions * float64(s.stepsPerRev))
+	positionSteps, err := s.toSteps("position", positionRevolutions)
+	if err != nil {
+		return multierr.Combine(err, saved.restore(ctx, s.comm))
+	}
+
+	if s.backlash.enabled() {
+		err = s.compensatedMove(ctx, command, positionSteps, revSec)
+	} else {
+		err = s.moveSteps(ctx, command, positionSteps, revSec)
+	}
+	return multierr.Combine(err, saved.restore(ctx, s.comm))
+}
+
+// moveSteps moves (FL for relative, FP for absolute) and waits for it to finish. The drive's
+// positions and distances are only 32 bits, so moves that go beyond that are split up.
+func (s *st) moveSteps(ctx context.Context, command string, positionSteps int64, revSec float64) error {
+	distanceSteps := positionSteps
+	if command == "FP" {
+		current, err := s.readSteps(ctx)
+		if err != nil {
+			return err
+		}
+		distanceSteps = positionSteps - current
+		// FP takes the target in the drive's own count. If it doesn't fit in that, move there
+		// relative to where we are instead.
+		positionSteps -= s.counter.driveOffset()
+		if positionSteps < math.MinInt32 || positionSteps > math.MaxInt32 {
+			command, positionSteps = "FL", distanceSteps
+		}
+	}
+	if command == "FL" {
+		// The count can only move 2^31 steps between reads before we lose track of its wraps, so
+		// read it before each segment of a split move.
+		split := false
+		for distanceSteps > maxMoveSteps || distanceSteps < -maxMoveSteps {
+			if _, err := s.readSteps(ctx); err != nil {
+				return err
+			}
+			split = true
+			segment := int64(maxMoveSteps)
+			if distanceSteps < 0 {
+				segment = -segment
+			}
+			s.logger.Debugf("Move of %d steps is too long for DI, moving %d steps first", distanceSteps, segment)
+			if err := s.sendMove(ctx, "FL", segment, segment, revSec); err != nil {
+				return err
+			}
+			distanceSteps -= segment
+		}
+		if split {
+			if _, err := s.readSteps(ctx); err != nil {
+				return err
+			}
+		}
+		positionSteps = distanceSteps
+	}
+	return s.sendMove(ctx, command, positionSteps, distanceSteps, revSec)
+}
+
+// sendMove sends a single move and waits for it to finish, or for it to run well past how long it
+// should have taken.
+func (s *st) sendMove(ctx context.Context, command string, positionSteps, distanceSteps int64, revSec float64) error {
+	timeout, err := s.moveTimeout(ctx, distanceSteps, revSec)
+	if err != nil {
+		return err
+	}
+
 	// Set the distance first
 	if _, err := s.comm.send(ctx, fmt.Sprintf("DI%d", positionSteps)); err != nil {
 		return err
@@ -332,8 +774,7 @@ func (s *st) configuredMove(
 	if _, err := s.comm.send(ctx, command); err != nil {
 		return err
 	}
-	return multierr.Combine(s.waitForMoveCommandToComplete(ctx),
-		oldAcceleration.restore(ctx, s.comm))
+	return s.waitForMoveCommandToComplete(ctx, timeout)
 }
 
 func (s *st) IsMoving(ctx context.Context) (bool, error) {
@@ -355,9 +796,18 @@ func (s *st) IsMoving(ctx context.Context) (bool, error) {
 func (s *st) IsPowered(ctx context.Context, extra map[string]interface{}) (bool, float64, error) {
 	// The same as IsMoving, don't lock the mutex.
 	s.logger.Debugf("IsPowered: extra=%v", extra)
-	status, err := s.getStatus(ctx)
-	if err != nil {
-		return false, 0, err
+	var status []byte
+	if fromDataManagement(extra) {
+		snap, err := s.capturedSnapshot()
+		if err != nil {
+			return false, 0, err
+		}
+		status = snap.status
+	} else {
+		var err error
+		if status, err = s.getStatus(ctx); err != nil {
+			return false, 0, err
+		}
 	}
 	if len(status) != 2 {
 		return false, 0, ErrStatusMessageIncorrectLength
@@ -365,35 +815,51 @@ func (s *st) IsPowered(ctx context.Context, extra map[string]interface{}) (bool,
 	// The second return value is supposed to be the fraction of power sent to the motor, between 0
 	// (off) and 1 (maximum power). It's unclear how to implement this for a stepper motor, so we
 	// return 0 no matter what.
-	return (status[1]&1 == 1), 0, err
+	return (status[1]&1 == 1), 0, nil
 }
 
 // Position implements motor.Motor.
 func (s *st) Position(ctx context.Context, extra map[string]interface{}) (float64, error) {
+	// Data capture is served from the background snapshot, so it doesn't need to wait for (or add
+	// traffic to) a move in progress.
+	if fromDataManagement(extra) {
+		snap, err := s.capturedSnapshot()
+		if err != nil {
+			return 0, err
+		}
+		return snap.position, nil
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.logger.Debugf("Position: extra=%v", extra)
+	return s.position(ctx)
+}
+
+// position returns the current position in user units. The caller must hold the mutex.
+func (s *st) position(ctx context.Context) (float64, error) {
+	steps, err := s.readSteps(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.conversion().position(steps), nil
+}
+
+// readSteps returns the motor's current position in steps, as counted by the drive.
+func (s *st) readSteps(ctx context.Context) (int64, error) {
+	return s.readStepsWith(ctx, s.comm)
+}
 
+// readStepsWith is readSteps with the given comm, for code that doesn't hold the mutex.
+func (s *st) readStepsWith(ctx context.Context, comm commPort) (int64, error) {
 	// Use EP if we've got an encoder plugged in (this struct currently doesn't support that).
 	// Use IP if we don't have an encoder and want to just count steps.
 	// The response should look something like IP=<num>
-	if resp, err := s.comm.send(ctx, "IP"); err != nil {
+	raw, err := queryImmediate(ctx, comm, "IP", 32)
+	if err != nil {
 		return 0, err
-	} else {
-		startIndex := strings.Index(resp, "=")
-		if startIndex == -1 {
-			return 0, fmt.Errorf("unexpected response %v", resp)
-		}
-		resp = resp[startIndex+1:]
-		if val, err := strconv.ParseUint(resp, 16, 32); err != nil {
-			return 0, err
-		} else {
-			// We parsed the value as though it was unsigned, but it's really signed. We can't
-			// parse it as signed originally because strconv expects the sign to be indicated by a
-			// "-" at the beginning, not by the most significant bit in the word. Convert it here.
-			return float64(int32(val)) / float64(s.stepsPerRev), nil
-		}
 	}
+	return s.counter.update(int32(raw)), nil
 }
 
 // Properties implements motor.Motor.
@@ -406,9 +872,26 @@ func (s *st) ResetZeroPosition(ctx context.Context, offset float64, extra map[st
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.logger.Debugf("ResetZeroPosition: offset=%v", offset)
+	if err := s.resetZeroPosition(ctx, offset); err != nil {
+		return err
+	}
+
+	// Keep the follower's zero lined up with ours, so it stays at ratio times our position.
+	if s.follower != nil {
+		return s.follower.motor.ResetZeroPosition(ctx, offset*s.follower.ratio, extra)
+	}
+	return nil
+}
 
-	// The driver only has 32 bits of precision. If we go beyond that, we're gonna have a bad time.
-	newCurrentPosition := int32(-offset * float64(s.stepsPerRev))
+// resetZeroPosition sets the current position to -offset, in user units. The caller must hold the
+// mutex.
+func (s *st) resetZeroPosition(ctx context.Context, offset float64) error {
+	// The drive counts motor steps, so take the backlash offset back out of the output position.
+	steps, err := s.toSteps("offset", -s.units.toMotorRevs(offset))
+	if err != nil {
+		return err
+	}
+	newCurrentPosition := steps - s.backlash.offset()
 
 	// The docs indicate that for proper reset, you must send both EP and SP. The EP is only
 	// important if we've got an encoder plugged in, though we currently don't support that. If we
@@ -416,16 +899,29 @@ func (s *st) ResetZeroPosition(ctx context.Context, offset float64, extra map[st
 	// current going to the motor while the encoder is being reset, so the motor can't wiggle
 	// around during the reset.
 
+	if err := s.setSteps(ctx, newCurrentPosition); err != nil {
+		return err
+	}
+	s.zeroed(ctx, offset)
+	return nil
+}
+
+// setSteps sets the step count. The drive only has 32 bits, so it gets the low 32 bits of the
+// count, and the step counter keeps track of the rest.
+func (s *st) setSteps(ctx context.Context, steps int64) error {
+	raw := int32(steps)
+
 	// First reset the encoder
-	if _, err := s.comm.send(ctx, fmt.Sprintf("EP%d", newCurrentPosition)); err != nil {
+	if _, err := s.comm.send(ctx, fmt.Sprintf("EP%d", raw)); err != nil {
 		return err
 	}
 
 	// Then reset the internal position
-	if _, err := s.comm.send(ctx, fmt.Sprintf("SP%d", newCurrentPosition)); err != nil {
+	if _, err := s.comm.send(ctx, fmt.Sprintf("SP%d", raw)); err != nil {
 		return err
 	}
 
+	s.counter.set(raw, steps)
 	return nil
 }
 
@@ -433,6 +929,16 @@ func (s *st) ResetZeroPosition(ctx context.Context, offset float64, extra map[st
 func (s *st) SetPower(ctx context.Context, powerPct float64, extra map[string]interface{}) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if err := s.checkEStop(); err != nil {
+		return err
+	}
+	if err := s.checkHomed(); err != nil {
+		return err
+	}
+	if err := s.checkHostMoves(); err != nil {
+		return err
+	}
+
 	// The GoTo and GoFor commands communicate the number of steps the motor should move, but
 	// SetPower requires telling the motor the number of revolutions per second the motor should
 	// spin at. Consequently, we need to tell it the number of steps per revolution, using the EG
@@ -446,12 +952,12 @@ func (s *st) SetPower(ctx context.Context, powerPct float64, extra map[string]in
 		return err
 	}
 
-	acceleration = s.accelLimits.Bound(acceleration, s.logger)
+	acceleration = s.accelLimits.Bound(s.units.toMotorRevs(acceleration), s.logger)
 	if _, err := s.comm.send(ctx, fmt.Sprintf("JA%f", acceleration)); err != nil {
 		return err
 	}
 
-	deceleration = s.decelLimits.Bound(deceleration, s.logger)
+	deceleration = s.decelLimits.Bound(s.units.toMotorRevs(deceleration), s.logger)
 	if _, err := s.comm.send(ctx, fmt.Sprintf("JL%f", deceleration)); err != nil {
 		return err
 	}
@@ -471,6 +977,18 @@ func (s *st) SetPower(ctx context.Context, powerPct float64, extra map[string]in
 	}
 	targetRPS := targetRPM / 60.0 // Revolutions per second, not per minute!
 
+	// We can't compensate for backlash while jogging, but we can remember which way we went so
+	// the position is still right afterwards.
+	if targetRPS > 0 {
+		s.setDirection(1)
+	} else if targetRPS < 0 {
+		s.setDirection(-1)
+	}
+
+	if err := s.releaseBrake(ctx); err != nil {
+		return err
+	}
+
 	// You might expect us to use DI to set the direction, JS to set the (unsigned) jogging speed,
 	// and then CJ to start continuous jogging. However, if you call SetPower again while we're
 	// already jogging, we need to use CS to set the new speed, which should be signed rather than
@@ -482,7 +1000,13 @@ func (s *st) SetPower(ctx context.Context, powerPct float64, extra map[string]in
 	if _, err := s.comm.send(ctx, fmt.Sprintf("CS%f", targetRPS)); err != nil {
 		return err
 	}
+	s.startStepTracker()
 
+	if s.follower != nil {
+		// The follower might have a different max_rpm, so tell it the speed rather than the power.
+		followerRPM := s.units.fromMotorRevs(targetRPM) * s.follower.ratio
+		return s.follower.motor.SetRPM(ctx, followerRPM, s.follower.scaleExtra(extra))
+	}
 	return nil
 }
 
@@ -492,18 +1016,27 @@ func (s *st) Stop(ctx context.Context, extras map[string]interface{}) error {
 	// SM - Stop Move? Stops and leaves queue intact?
 	// ST - Halts the current buffered command being executed, but does not affect other buffered commands in the command buffer
 	s.logger.Debugf("Stop called with %v", extras)
-	_, err := s.comm.send(ctx, "SK") // Stop the current move and clear any queued moves, too.
+	// Stop doesn't wait for the mutex, since a move in progress holds it.
+	shared := s.shared()
+	s.stopStepTracker()
+	_, err := shared.comm.send(ctx, "SK") // Stop the current move and clear any queued moves, too.
 	if err != nil {
 		return err
 	}
+	// If the motor stopped because the drive faulted and disabled it, nothing is holding the load.
+	// Like the SK, this uses the comm and brake from shared(), since Reconfigure may be replacing
+	// them.
+	if shared.brake != nil {
+		status, err := readStatus(ctx, shared.comm)
+		if err != nil {
+			return err
+		}
+		if err := shared.brake.engageIfDisabled(ctx, shared.comm, status, s.logger); err != nil {
+			return err
+		}
+	}
+	if shared.follower != nil {
+		return shared.follower.motor.Stop(ctx, extras)
+	}
 	return nil
 }
-
-func (s *st) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.logger.Debug("DoCommand called with %v", cmd)
-	command := cmd["command"].(string)
-	response, err := s.comm.send(ctx, command)
-	return map[string]interface{}{"response": response}, err
-}
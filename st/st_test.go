@@ -174,15 +174,15 @@ func TestDoCommand(t *testing.T) {
 	assert.Nil(t, err, "failed to construct motor")
 	defer motor.Close(ctx)
 
-	_, err = motor.DoCommand(ctx, map[string]interface{}{"command": "DI20000"})
+	_, err = motor.DoCommand(ctx, map[string]interface{}{"command": "raw", "scl": "DI20000"})
 	assert.Nil(t, err, "error executing do command")
-	_, err = motor.DoCommand(ctx, map[string]interface{}{"command": "VE1"})
+	_, err = motor.DoCommand(ctx, map[string]interface{}{"command": "raw", "scl": "VE1"})
 	assert.Nil(t, err, "error executing do command")
-	_, err = motor.DoCommand(ctx, map[string]interface{}{"command": "AC100"})
+	_, err = motor.DoCommand(ctx, map[string]interface{}{"command": "raw", "scl": "AC100"})
 	assert.Nil(t, err, "error executing do command")
-	_, err = motor.DoCommand(ctx, map[string]interface{}{"command": "DE100"})
+	_, err = motor.DoCommand(ctx, map[string]interface{}{"command": "raw", "scl": "DE100"})
 	assert.Nil(t, err, "error executing do command")
-	resp, err := motor.DoCommand(ctx, map[string]interface{}{"command": "FL"})
+	resp, err := motor.DoCommand(ctx, map[string]interface{}{"command": "raw", "scl": "FL"})
 	assert.Nil(t, err, "error executing do command")
 	assert.NotNil(t, resp["response"], "response should not be nil")
 }
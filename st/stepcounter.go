@@ -0,0 +1,131 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.viam.com/utils"
+)
+
+// ErrPositionOutOfRange is returned for positions too far from 0 for us to keep track of.
+var ErrPositionOutOfRange = errors.New("position out of range")
+
+const (
+	// The furthest from 0 we keep track of, in steps. Positions are float64 in user units, and
+	// this is as far as those can still count every step.
+	maxTrackedSteps = 1 << 53
+
+	// The longest relative move DI can hold, in steps.
+	maxMoveSteps = math.MaxInt32
+
+	// How often we read the step count while jogging. 2^31 steps take about 22 minutes at 80 rps
+	// and 20000 steps/rev, and still minutes at the finest resolutions, so this is plenty.
+	stepTrackInterval = 10 * time.Second
+)
+
+// stepCounter extends the drive's step count (IP), which is only 32 bits and wraps around after
+// about 107,000 revolutions at 20000 steps/rev, to 64 bits. Every time we read the count, we add
+// how far it has changed since the last read. That's right as long as the motor moves less than
+// 2^31 steps between reads, which is only about 22 minutes at 80 rps and 20000 steps/rev. Long
+// moves read the count between their segments, and jogging starts a stepTracker, so we don't rely
+// on someone calling Position often enough.
+type stepCounter struct {
+	mu    sync.Mutex
+	known bool
+	raw   int32
+	steps int64
+}
+
+// update records a new reading of the drive's count, and returns the 64-bit count.
+func (c *stepCounter) update(raw int32) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.known {
+		// The subtraction wraps around in the same way as the drive's count, so this is the
+		// distance moved even if the count wrapped in between.
+		c.steps += int64(raw - c.raw)
+	} else {
+		// The first time, we have no way to know how many times the count has already wrapped.
+		c.steps = int64(raw)
+		c.known = true
+	}
+	c.raw = raw
+	return c.steps
+}
+
+// set records that the drive's count is raw, which stands for steps.
+func (c *stepCounter) set(raw int32, steps int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.known = true
+	c.raw = raw
+	c.steps = steps
+}
+
+// driveOffset returns how far the 64-bit count is ahead of the drive's own count.
+func (c *stepCounter) driveOffset() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.steps - int64(c.raw)
+}
+
+// stepTracker reads the step count every stepTrackInterval while the motor jogs, so that no wraps
+// are missed however long it runs.
+type stepTracker struct {
+	cancel   func()
+	finished chan struct{}
+}
+
+// startStepTracker starts tracking the step count, unless the status poller is already reading it
+// often enough. The caller must hold the mutex.
+func (s *st) startStepTracker() {
+	s.stopStepTracker()
+	s.pollerMu.Lock()
+	polled := s.poller != nil && s.poller.interval <= stepTrackInterval
+	s.pollerMu.Unlock()
+	if polled {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &stepTracker{cancel: cancel, finished: make(chan struct{})}
+	utils.PanicCapturingGo(func() {
+		defer close(t.finished)
+		for utils.SelectContextOrWait(ctx, stepTrackInterval) {
+			if _, err := s.readSteps(ctx); err != nil && ctx.Err() == nil {
+				s.logger.Warnf("Unable to read the step count while jogging: %v", err)
+			}
+		}
+	})
+	s.trackerMu.Lock()
+	s.tracker = t
+	s.trackerMu.Unlock()
+}
+
+// stopStepTracker stops tracking the step count, and returns whether it was being tracked.
+func (s *st) stopStepTracker() bool {
+	s.trackerMu.Lock()
+	t := s.tracker
+	s.tracker = nil
+	s.trackerMu.Unlock()
+	if t == nil {
+		return false
+	}
+	t.cancel()
+	<-t.finished
+	return true
+}
+
+// toSteps converts a number of motor revolutions into steps, or returns ErrPositionOutOfRange if
+// it's too big to keep track of.
+func (s *st) toSteps(what string, revolutions float64) (int64, error) {
+	steps := revolutions * float64(s.stepsPerRev)
+	if math.IsNaN(steps) || math.Abs(steps) > maxTrackedSteps {
+		return 0, fmt.Errorf("%w: %s of %v is %v steps, which is more than the %d steps we can keep track of",
+			ErrPositionOutOfRange, what, s.units.fromMotorRevs(revolutions), steps, int64(maxTrackedSteps))
+	}
+	return int64(steps), nil
+}
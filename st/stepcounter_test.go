@@ -0,0 +1,66 @@
+package st
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepCounterWraps(t *testing.T) {
+	var c stepCounter
+	assert.Equal(t, int64(math.MaxInt32-10), c.update(math.MaxInt32-10))
+	assert.Equal(t, int64(math.MaxInt32+11), c.update(math.MinInt32+10))
+	assert.Equal(t, int64(1<<32), c.driveOffset())
+	assert.Equal(t, int64(math.MaxInt32-10), c.update(math.MaxInt32-10))
+	assert.Equal(t, int64(0), c.driveOffset())
+}
+
+func TestLargeZeroOffset(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		{"EP-1294967296", "%"},
+		{"SP-1294967296", "%"},
+		{"IP", "IP=B2D05E10"},
+	})
+
+	// 3e9 steps doesn't fit in the drive, but we can still keep track of it.
+	assert.Nil(t, s.resetZeroPosition(ctx, -150000))
+	position, err := s.position(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 150000.0008, position)
+
+	assert.ErrorIs(t, s.resetZeroPosition(ctx, 1e12), ErrPositionOutOfRange)
+	assert.ErrorIs(t, s.resetZeroPosition(ctx, math.NaN()), ErrPositionOutOfRange)
+	assert.Nil(t, s.comm.Close())
+}
+
+func TestLongMoveIsSplit(t *testing.T) {
+	ctx := context.Background()
+	move := func(distance string) [][2]string {
+		return [][2]string{
+			{"AC", "AC=25"},
+			{"DE", "DE=25"},
+			{"DI" + distance, "%"},
+			{"VE1.0000", "%"},
+			{"FL", "%"},
+			{"BS", "BS=63"},
+			{"SC", "SC=0009"},
+		}
+	}
+	script := [][2]string{{"IP", "IP=00000000"}}
+	script = append(script, move("2147483647")...)
+	script = append(script, [2]string{"IP", "IP=7FFFFFFF"})
+	script = append(script, move("5")...)
+	script = append(script, [2]string{"IP", "IP=80000004"})
+	s := replayMotor(t, script)
+	s.moveTimeoutFactor = defaultMoveTimeoutFactor
+	assert.Nil(t, s.moveSteps(ctx, "FL", maxMoveSteps+5, 1))
+
+	// The count wrapped during the last segment, which the read before it lets us notice.
+	steps, err := s.readSteps(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(maxMoveSteps+5), steps)
+	assert.Nil(t, s.comm.Close())
+}
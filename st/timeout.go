@@ -0,0 +1,94 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"viam/viam-appliedmotion/common"
+)
+
+// ErrMoveTimeout is returned when a move runs for much longer than it should have, which usually
+// means the drive faulted or we lost track of it. The motor is stopped before this is returned.
+var ErrMoveTimeout = errors.New("move took too long to complete")
+
+const (
+	defaultMoveTimeoutFactor = 2.0
+	// Extra time on top of every estimate, to cover polling and round trips to the drive.
+	moveTimeoutGrace = time.Second
+)
+
+// readAccelerations returns the acceleration and deceleration currently set on the drive, in
+// revs/sec^2. We ask rather than remembering, since an override or a raw DoCommand could have
+// changed them.
+func (s *st) readAccelerations(ctx context.Context) (float64, float64, error) {
+	read := func(command string) (float64, error) {
+		resp, err := s.comm.query(ctx, command)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseFloat(strings.TrimSpace(resp), 64)
+	}
+	accel, err := read("AC")
+	if err != nil {
+		return 0, 0, err
+	}
+	decel, err := read("DE")
+	if err != nil {
+		return 0, 0, err
+	}
+	return accel, decel, nil
+}
+
+// estimateMove returns how long a move of the given number of motor revolutions should take, at
+// revSec and with the acceleration and deceleration currently set on the drive.
+func (s *st) estimateMove(ctx context.Context, revolutions, revSec float64) (time.Duration, error) {
+	accel, decel, err := s.readAccelerations(ctx)
+	if err != nil {
+		return 0, err
+	}
+	seconds := common.TrapezoidDuration(revolutions, revSec, accel, decel)
+	if math.IsInf(seconds, 1) {
+		return 0, fmt.Errorf("a move at %f revs/sec will never finish", revSec)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// moveTimeout returns how long to wait for a move of the given number of steps before giving up.
+func (s *st) moveTimeout(ctx context.Context, steps int64, revSec float64) (time.Duration, error) {
+	expected, err := s.estimateMove(ctx, float64(steps)/float64(s.stepsPerRev), revSec)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(float64(expected)*s.moveTimeoutFactor) + moveTimeoutGrace, nil
+}
+
+// estimateFromCommand handles the estimate_move DoCommand. It takes the same arguments as GoFor
+// (or GoTo, if "absolute" is true) in user units, and returns how long that move should take
+// without moving anything.
+func (s *st) estimateFromCommand(ctx context.Context, args map[string]interface{}) (time.Duration, error) {
+	rpm, err := extraFloat(args, "rpm")
+	if err != nil {
+		return 0, err
+	}
+	position, err := extraFloat(args, "position")
+	if err != nil {
+		return 0, err
+	}
+	absolute, _ := args["absolute"].(bool)
+
+	revolutions := s.units.toMotorRevs(position)
+	if absolute {
+		current, err := s.position(ctx)
+		if err != nil {
+			return 0, err
+		}
+		revolutions = s.units.toMotorRevs(position - current)
+	}
+	revSec := s.rpmLimits.Bound(math.Abs(s.units.toMotorRevs(rpm)), s.logger) / 60
+	return s.estimateMove(ctx, revolutions, revSec)
+}
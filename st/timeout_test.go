@@ -0,0 +1,46 @@
+package st
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateMove(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		{"AC", "AC=10"},
+		{"DE", "DE=10"},
+		{"AC", "AC=10"},
+		{"DE", "DE=10"},
+		{"AC", "AC=10"},
+		{"DE", "DE=5"},
+	})
+	s.moveTimeoutFactor = defaultMoveTimeoutFactor
+
+	// 0.1 seconds to get up to speed, 0.1 seconds to slow down, and 9.9 revolutions in between.
+	estimate, err := s.estimateMove(ctx, -10, 1)
+	assert.Nil(t, err)
+	assert.InDelta(t, 10.1, estimate.Seconds(), 1e-9)
+
+	_, err = s.estimateMove(ctx, 10, 0)
+	assert.ErrorContains(t, err, "will never finish")
+
+	// The same move, in steps, with twice as long plus the grace period before giving up. This
+	// time the deceleration is slower, which adds 0.05 seconds.
+	timeout, err := s.moveTimeout(ctx, 200000, 1)
+	assert.Nil(t, err)
+	assert.InDelta(t, 2*10.15+moveTimeoutGrace.Seconds(), timeout.Seconds(), 1e-9)
+	assert.Nil(t, s.comm.Close())
+}
+
+func TestMoveOverrun(t *testing.T) {
+	// The move is still going when the timeout runs out, so it's stopped before the drive is even
+	// asked whether it's done.
+	s := replayMotor(t, [][2]string{{"SK", "%"}})
+	err := s.waitForMoveCommandToComplete(context.Background(), 10*time.Millisecond)
+	assert.ErrorIs(t, err, ErrMoveTimeout)
+	assert.Nil(t, s.comm.Close(), "the motor should have been stopped")
+}
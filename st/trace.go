@@ -0,0 +1,169 @@
+package st
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrReplayMismatch is returned when replaying a trace and the module sends a different command
+	// than the one that was recorded.
+	ErrReplayMismatch = errors.New("command does not match the trace")
+	// ErrReplayExhausted is returned when replaying a trace and the module sends more commands than
+	// were recorded.
+	ErrReplayExhausted = errors.New("no more commands in the trace")
+)
+
+// traceEntry is one line of a trace file: a command we sent and what the drive said back.
+type traceEntry struct {
+	Time     time.Time `json:"time"`
+	Command  string    `json:"command"`
+	Response string    `json:"response"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// tracer writes every command sent to the drive, and its response, to a file as JSON lines.
+type tracer struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// openTrace opens the trace file for appending, so that reconnecting doesn't overwrite what has
+// already been recorded.
+func openTrace(path string) (*tracer, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open trace file: %w", err)
+	}
+	return &tracer{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// write records a single exchange. It is safe to call on a nil *tracer.
+func (t *tracer) write(command, response string, err error) error {
+	if t == nil {
+		return nil
+	}
+	entry := traceEntry{Time: time.Now().UTC(), Command: command, Response: response}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.encoder.Encode(entry)
+}
+
+func (t *tracer) close() error {
+	if t == nil {
+		return nil
+	}
+	return t.file.Close()
+}
+
+func readTrace(path string) ([]traceEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []traceEntry
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry traceEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// replay stands in for the connection to the drive, and answers each command with the response
+// from a recorded trace. It checks that every command is the same one that was recorded.
+type replay struct {
+	mu         sync.Mutex
+	path       string
+	entries    []traceEntry
+	next       int
+	current    *traceEntry
+	mismatches []string
+}
+
+func newReplay(path string) (*replay, error) {
+	entries, err := readTrace(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read trace: %w", err)
+	}
+	return &replay{path: path, entries: entries}, nil
+}
+
+func (r *replay) Write(buffer []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Strip the 0x00 0x07 header and the trailing carriage return, like the drive would.
+	if len(buffer) < 3 {
+		return 0, fmt.Errorf("packet too short to replay: %#v", buffer)
+	}
+	command := string(buffer[2 : len(buffer)-1])
+
+	r.current = nil
+	if r.next >= len(r.entries) {
+		r.mismatches = append(r.mismatches, fmt.Sprintf("entry %d: sent %q after the end of the trace",
+			r.next+1, command))
+		return 0, fmt.Errorf("%w: sent %q", ErrReplayExhausted, command)
+	}
+	entry := r.entries[r.next]
+	r.next++
+	if entry.Command != command {
+		mismatch := fmt.Sprintf("entry %d: expected %q, sent %q", r.next, entry.Command, command)
+		r.mismatches = append(r.mismatches, mismatch)
+		return 0, fmt.Errorf("%w: %s", ErrReplayMismatch, mismatch)
+	}
+	r.current = &entry
+	return len(buffer), nil
+}
+
+func (r *replay) Read(buffer []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current == nil {
+		return 0, errors.New("read without a matching command")
+	}
+	entry := r.current
+	r.current = nil
+	if entry.Error != "" {
+		return 0, errors.New(entry.Error)
+	}
+	packet := append(append([]byte{0, 7}, entry.Response...), '\r')
+	return copy(buffer, packet), nil
+}
+
+// Close reports any commands left over in the trace, since it means the module sent fewer
+// commands than were recorded.
+func (r *replay) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next < len(r.entries) {
+		return fmt.Errorf("replay of %s ended with %d commands left over, starting with %q",
+			r.path, len(r.entries)-r.next, r.entries[r.next].Command)
+	}
+	return nil
+}
+
+// replayMismatches returns a description of every command that didn't match the trace.
+func (r *replay) replayMismatches() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.mismatches...)
+}
@@ -0,0 +1,52 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/logging"
+)
+
+func TestTraceReplay(t *testing.T) {
+	ctx := context.Background()
+	logger := logging.NewTestLogger(t)
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+
+	trace, err := openTrace(path)
+	assert.Nil(t, err)
+	assert.Nil(t, trace.write("SC", "SC=0019", nil))
+	assert.Nil(t, trace.write("SC", "SC=0009", nil))
+	assert.Nil(t, trace.write("IP", "", errors.New("i/o timeout")))
+	assert.Nil(t, trace.close())
+
+	comm, err := newReplayComm(path, nil, logger)
+	assert.Nil(t, err)
+	s := &st{logger: logger, comm: comm}
+
+	moving, err := s.IsMoving(ctx)
+	assert.Nil(t, err)
+	assert.True(t, moving)
+	moving, err = s.IsMoving(ctx)
+	assert.Nil(t, err)
+	assert.False(t, moving)
+
+	// Recorded errors are replayed, too.
+	_, err = comm.send(ctx, "IP")
+	assert.EqualError(t, err, "i/o timeout")
+
+	_, err = comm.send(ctx, "SC")
+	assert.ErrorIs(t, err, ErrReplayExhausted)
+	assert.Equal(t, []string{`entry 4: sent "SC" after the end of the trace`},
+		comm.handle.(*replay).replayMismatches())
+
+	comm, err = newReplayComm(path, nil, logger)
+	assert.Nil(t, err)
+	_, err = comm.send(ctx, "IP")
+	assert.ErrorIs(t, err, ErrReplayMismatch)
+	assert.Equal(t, []string{`entry 1: expected "SC", sent "IP"`},
+		comm.handle.(*replay).replayMismatches())
+	assert.NotNil(t, comm.Close(), "closing with unused commands should be reported")
+}
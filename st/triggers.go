@@ -0,0 +1,242 @@
+package st
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.viam.com/utils"
+)
+
+// How often triggered moves read the position, unless poll_interval_ms says otherwise. Between
+// reads, the link is free for the status poller and e-stop inputs on the drive.
+const defaultTriggerPollInterval = 10 * time.Millisecond
+
+// positionTrigger changes one of the drive's outputs once a move gets to a position.
+type positionTrigger struct {
+	position float64 // From the start of the move, in user units
+	output   string  // Such as "Y2"
+	level    string  // "H" or "L", like SO
+	target   int64   // Where to fire, in the drive's steps
+	fired    bool
+	captured float64 // Where the motor was when we saw it pass the trigger, in user units
+}
+
+// parseTriggers reads the triggers argument: a list of objects like
+// {"position": 2.5, "output": "Y2", "level": "L"}.
+func parseTriggers(val interface{}) ([]*positionTrigger, error) {
+	list, ok := val.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("triggers must be a list of {position, output, level}, got %#v", val)
+	}
+	var triggers []*positionTrigger
+	for i, item := range list {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("trigger %d must be an object, got %#v", i, item)
+		}
+		position, ok := fields["position"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("trigger %d needs a numeric position", i)
+		}
+		output, err := stringArg(fields, "output", true)
+		if err != nil {
+			return nil, fmt.Errorf("trigger %d: %w", i, err)
+		}
+		if !outputPattern.MatchString(output) {
+			return nil, fmt.Errorf("trigger %d output must be a drive output like Y2, got %#v", i, output)
+		}
+		level, err := stringArg(fields, "level", true)
+		if err != nil {
+			return nil, fmt.Errorf("trigger %d: %w", i, err)
+		}
+		if level != "H" && level != "L" {
+			return nil, fmt.Errorf("trigger %d level must be \"H\" or \"L\", got %#v", i, level)
+		}
+		triggers = append(triggers, &positionTrigger{position: position, output: output, level: level})
+	}
+	return triggers, nil
+}
+
+// triggeredMove is a GoFor that changes outputs at positions along the way. The triggers are run
+// from here rather than from a Q program, so they work on drives without Q programs and don't
+// need one stored on the drive: we read the position every pollInterval and send SO once a trigger
+// has been passed. How far past its position a trigger fires depends on the speed, the poll
+// interval and the round trip time to the drive, which is why we report where the motor was.
+func (s *st) triggeredMove(
+	ctx context.Context,
+	rpm, position float64,
+	triggers []*positionTrigger,
+	pollInterval time.Duration,
+) (map[string]interface{}, error) {
+	if err := s.checkEStop(); err != nil {
+		return nil, err
+	}
+	if err := s.checkHomed(); err != nil {
+		return nil, err
+	}
+	if err := s.checkHostMoves(); err != nil {
+		return nil, err
+	}
+	if s.follower != nil {
+		return nil, errors.New("triggered moves don't move the follower, use GoFor instead")
+	}
+	if rpm == 0 {
+		return nil, errors.New("rpm must be nonzero")
+	}
+
+	// Like GoFor, a negative speed flips the direction of travel. The trigger positions are
+	// along the move, so they flip, too.
+	sign := 1.0
+	if rpm < 0 {
+		rpm *= -1
+		position *= -1
+		sign = -1
+	}
+	for _, t := range triggers {
+		if sign*t.position*position < 0 || math.Abs(t.position) > math.Abs(position) {
+			return nil, fmt.Errorf("trigger at %v is outside of the move to %v", t.position, position)
+		}
+		if err := s.drive.caps.checkIO(t.output); err != nil {
+			return nil, err
+		}
+		if s.brake != nil && t.output == s.brake.conf.Output {
+			return nil, fmt.Errorf("%s is the brake output", t.output)
+		}
+	}
+
+	distance, err := s.toSteps("position", s.units.toMotorRevs(position))
+	if err != nil {
+		return nil, err
+	}
+	if distance > maxMoveSteps || distance < -maxMoveSteps {
+		return nil, fmt.Errorf("%w: triggered moves can't be split, so they can be at most %d steps",
+			ErrPositionOutOfRange, maxMoveSteps)
+	}
+	revSec := s.rpmLimits.Bound(s.units.toMotorRevs(rpm), s.logger) / 60
+
+	if err := s.stopMovement(ctx); err != nil {
+		return nil, err
+	}
+	defer s.savePosition(context.WithoutCancel(ctx))
+	if err := s.releaseBrake(ctx); err != nil {
+		return nil, err
+	}
+
+	start, err := s.readSteps(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range triggers {
+		offset, err := s.toSteps("trigger position", s.units.toMotorRevs(sign*t.position))
+		if err != nil {
+			return nil, err
+		}
+		t.target = start + offset
+	}
+	direction := int64(1)
+	if distance < 0 {
+		direction = -1
+	}
+	// Fire them in the order the move reaches them, but report them in the order we were given.
+	ordered := append([]*positionTrigger{}, triggers...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return direction*ordered[i].target < direction*ordered[j].target
+	})
+
+	timeout, err := s.moveTimeout(ctx, distance, revSec)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	if _, err := s.comm.send(ctx, fmt.Sprintf("DI%d", distance)); err != nil {
+		return nil, err
+	}
+	if err := s.comm.store(ctx, "VE", revSec); err != nil {
+		return nil, err
+	}
+	if _, err := s.comm.send(ctx, "FL"); err != nil {
+		return nil, err
+	}
+	s.setDirection(int(direction))
+
+	if err := s.fireTriggers(ctx, ordered, direction, deadline, pollInterval); err != nil {
+		return triggerResults(triggers), multierr.Combine(err, s.Stop(context.WithoutCancel(ctx), nil))
+	}
+	// Every trigger has fired, so all that's left is to wait for the end of the move.
+	remaining := time.Until(deadline)
+	if remaining < time.Millisecond {
+		remaining = time.Millisecond
+	}
+	return triggerResults(triggers), s.waitForMoveCommandToComplete(ctx, remaining)
+}
+
+// fireTriggers polls the position, and fires each trigger once the motor reaches it.
+func (s *st) fireTriggers(
+	ctx context.Context,
+	ordered []*positionTrigger,
+	direction int64,
+	deadline time.Time,
+	pollInterval time.Duration,
+) error {
+	next := 0
+	for {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: only reached %d of %d triggers", ErrMoveTimeout, next, len(ordered))
+		}
+		steps, err := s.readSteps(ctx)
+		if err != nil {
+			return err
+		}
+		for next < len(ordered) && direction*(steps-ordered[next].target) >= 0 {
+			if err := s.fireTrigger(ctx, ordered[next], steps); err != nil {
+				return err
+			}
+			next++
+		}
+		if next == len(ordered) {
+			return nil
+		}
+		if !utils.SelectContextOrWait(ctx, pollInterval) {
+			return ctx.Err()
+		}
+	}
+}
+
+// fireTrigger sets the trigger's output. steps is the reading that showed the motor had passed
+// the trigger, which is the closest we have to where it was when the output changed.
+func (s *st) fireTrigger(ctx context.Context, t *positionTrigger, steps int64) error {
+	resp, err := s.comm.send(ctx, "SO"+t.output[1:]+t.level)
+	if err != nil {
+		return fmt.Errorf("unable to set %s for the trigger at %v: %w", t.output, t.position, err)
+	}
+	// A buffered SO ("*") would wait in the drive's queue until the move is over.
+	if resp != "%" {
+		return fmt.Errorf("the drive didn't set %s right away (it responded %#v), so it can't fire "+
+			"triggers during a move", t.output, resp)
+	}
+	t.fired = true
+	t.captured = s.conversion().position(steps)
+	return nil
+}
+
+func triggerResults(triggers []*positionTrigger) map[string]interface{} {
+	var results []interface{}
+	for _, t := range triggers {
+		result := map[string]interface{}{
+			"position": t.position,
+			"output":   t.output,
+			"level":    t.level,
+			"fired":    t.fired,
+		}
+		if t.fired {
+			result["captured_position"] = t.captured
+		}
+		results = append(results, result)
+	}
+	return map[string]interface{}{"triggers": results}
+}
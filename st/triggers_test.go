@@ -0,0 +1,49 @@
+package st
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriggeredMove(t *testing.T) {
+	ctx := context.Background()
+	s := replayMotor(t, [][2]string{
+		{"SK", "%"},
+		{"IP", "IP=00000000"},
+		{"AC", "AC=25"},
+		{"DE", "DE=25"},
+		{"DI20000", "%"},
+		{"VE1.0000", "%"},
+		{"FL", "%"},
+		{"IP", "IP=00001388"},
+		{"IP", "IP=00002711"},
+		{"SO2L", "%"},
+		{"IP", "IP=00004E20"},
+		{"SO3H", "%"},
+		{"BS", "BS=63"},
+		{"SC", "SC=0009"},
+	})
+	s.moveTimeoutFactor = defaultMoveTimeoutFactor
+
+	triggers, err := parseTriggers([]interface{}{
+		map[string]interface{}{"position": 1.0, "output": "Y3", "level": "H"},
+		map[string]interface{}{"position": 0.5, "output": "Y2", "level": "L"},
+	})
+	assert.Nil(t, err)
+	result, err := s.triggeredMove(ctx, 60, 1, triggers, time.Millisecond)
+	assert.Nil(t, err)
+	assert.Nil(t, s.comm.Close())
+
+	// The results come back in the order they were given, with the reading that passed each trigger.
+	fired := result["triggers"].([]interface{})
+	assert.Equal(t, 1.0, fired[0].(map[string]interface{})["captured_position"])
+	assert.Equal(t, 0.50005, fired[1].(map[string]interface{})["captured_position"])
+
+	_, err = parseTriggers([]interface{}{map[string]interface{}{"position": 1.0, "output": "X3", "level": "H"}})
+	assert.ErrorContains(t, err, "must be a drive output")
+	_, err = s.triggeredMove(ctx, 60, 1, []*positionTrigger{{position: 2, output: "Y2", level: "L"}}, time.Millisecond)
+	assert.ErrorContains(t, err, "outside of the move")
+}
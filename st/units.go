@@ -0,0 +1,78 @@
+package st
+
+import "sync"
+
+// userUnits converts between motor revolutions and the units the user works in. The motor turns
+// gearRatio times for every turn of the output (e.g., of the gearbox), and the output moves
+// unitsPerRev units (e.g., millimeters of leadscrew travel) for every one of its turns. With the
+// defaults of 1 and 1, user units are just motor revolutions.
+type userUnits struct {
+	gearRatio   float64
+	unitsPerRev float64
+	label       string
+}
+
+func newUserUnits(conf *Config) userUnits {
+	u := userUnits{gearRatio: conf.GearRatio, unitsPerRev: conf.UnitsPerRev, label: conf.Units}
+	if u.gearRatio == 0 {
+		u.gearRatio = 1
+	}
+	if u.unitsPerRev == 0 {
+		u.unitsPerRev = 1
+	}
+	if u.label == "" {
+		u.label = "revolutions"
+	}
+	return u
+}
+
+// toMotorRevs converts a distance in user units to motor revolutions. Since the conversion is
+// linear, it works just as well for speeds and accelerations (e.g., mm/sec to revs/sec).
+func (u userUnits) toMotorRevs(value float64) float64 {
+	return value / u.unitsPerRev * u.gearRatio
+}
+
+// fromMotorRevs converts a distance in motor revolutions to user units. Like toMotorRevs, this
+// works for speeds and accelerations, too.
+func (u userUnits) fromMotorRevs(value float64) float64 {
+	return value / u.gearRatio * u.unitsPerRev
+}
+
+// conversion is everything it takes to turn the drive's step count into a position in user units.
+// Code that runs without the mutex, such as the recorder, reads a copy of it from conversions,
+// which is updated whenever the config or the backlash direction changes.
+type conversion struct {
+	units          userUnits
+	stepsPerRev    int64
+	backlashOffset int64 // in steps
+}
+
+// position converts a step count into a position in user units.
+func (c conversion) position(steps int64) float64 {
+	return c.units.fromMotorRevs(float64(steps+c.backlashOffset) / float64(c.stepsPerRev))
+}
+
+// conversions holds the latest conversion.
+type conversions struct {
+	mu      sync.Mutex
+	current conversion
+}
+
+// updateConversion publishes the current units, steps per rev and backlash direction. The caller
+// must hold the mutex.
+func (s *st) updateConversion() {
+	s.conversions.mu.Lock()
+	defer s.conversions.mu.Unlock()
+	s.conversions.current = conversion{
+		units:          s.units,
+		stepsPerRev:    s.stepsPerRev,
+		backlashOffset: s.backlash.offset(),
+	}
+}
+
+// conversion returns the latest conversion, without needing the mutex.
+func (s *st) conversion() conversion {
+	s.conversions.mu.Lock()
+	defer s.conversions.mu.Unlock()
+	return s.conversions.current
+}
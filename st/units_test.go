@@ -0,0 +1,21 @@
+package st
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserUnits(t *testing.T) {
+	// With nothing configured, user units are motor revolutions.
+	u := newUserUnits(&Config{})
+	assert.Equal(t, 2.5, u.toMotorRevs(2.5))
+	assert.Equal(t, 2.5, u.fromMotorRevs(2.5))
+	assert.Equal(t, "revolutions", u.label)
+
+	// A 10:1 gearbox driving a 5 mm leadscrew: the motor turns 10 times per 5 mm.
+	u = newUserUnits(&Config{GearRatio: 10, UnitsPerRev: 5, Units: "mm"})
+	assert.InDelta(t, 10.0, u.toMotorRevs(5), 1e-9)
+	assert.InDelta(t, 5.0, u.fromMotorRevs(10), 1e-9)
+	assert.InDelta(t, -3.0, u.fromMotorRevs(u.toMotorRevs(-3)), 1e-9)
+}
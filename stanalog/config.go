@@ -0,0 +1,16 @@
+package stanalog
+
+import "errors"
+
+type Config struct {
+	// The st motor whose drive the analog input is on
+	Motor string `json:"motor"`
+}
+
+// Validate ensures all parts of the config are valid.
+func (conf *Config) Validate(path string) ([]string, error) {
+	if conf.Motor == "" {
+		return nil, errors.New("motor is required")
+	}
+	return []string{conf.Motor}, nil
+}
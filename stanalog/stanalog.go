@@ -0,0 +1,57 @@
+package stanalog
+
+import (
+	"context"
+
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+var Model = resource.NewModel("viam", "appliedmotion", "st-analog")
+
+// stAnalog is a sensor for the analog input of an st motor's drive, so that it can be read and
+// captured like any other sensor. The motor does the reading and scaling, as set up by its
+// analog_input config.
+type stAnalog struct {
+	resource.Named
+	resource.AlwaysRebuild
+	resource.TriviallyCloseable
+	logger logging.Logger
+	motor  motor.Motor
+}
+
+func init() {
+	resource.RegisterComponent(
+		sensor.API,
+		Model,
+		resource.Registration[sensor.Sensor, *Config]{Constructor: newAnalog})
+}
+
+func newAnalog(
+	ctx context.Context, deps resource.Dependencies, conf resource.Config, logger logging.Logger,
+) (sensor.Sensor, error) {
+	newConf, err := resource.NativeConfig[*Config](conf)
+	if err != nil {
+		return nil, err
+	}
+	m, err := motor.FromDependencies(deps, newConf.Motor)
+	if err != nil {
+		return nil, err
+	}
+	return &stAnalog{Named: conf.ResourceName().AsNamed(), logger: logger, motor: m}, nil
+}
+
+// Readings returns the "raw" voltage on the analog input and its scaled "value".
+func (a *stAnalog) Readings(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
+	resp, err := a.motor.DoCommand(ctx, map[string]interface{}{"command": "read_analog"})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"raw": resp["raw"], "value": resp["value"]}, nil
+}
+
+func (a *stAnalog) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	return nil, resource.ErrDoUnimplemented
+}
@@ -0,0 +1,28 @@
+package stanalog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/components/motor"
+)
+
+// fakeMotor answers read_analog like an st motor would.
+type fakeMotor struct {
+	motor.Motor
+}
+
+func (m *fakeMotor) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{"raw": 5.6, "value": 0.2}, nil
+}
+
+func TestReadings(t *testing.T) {
+	a := &stAnalog{motor: &fakeMotor{}}
+	readings, err := a.Readings(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"raw": 5.6, "value": 0.2}, readings)
+
+	_, err = (&Config{}).Validate("")
+	assert.ErrorContains(t, err, "motor is required")
+}
@@ -0,0 +1,54 @@
+package stgantry
+
+import (
+	"errors"
+	"fmt"
+)
+
+type AxisConfig struct {
+	Motor    string  `json:"motor"`
+	MmPerRev float64 `json:"mm_per_rev"`
+	LengthMm float64 `json:"length_mm"`
+
+	// Used to plan MoveToPosition, so that every axis arrives together
+	Acceleration float64 `json:"accel_mm_per_sec_squared"`
+	Deceleration float64 `json:"decel_mm_per_sec_squared"`
+}
+
+type Config struct {
+	Axes []AxisConfig `json:"axes"`
+
+	// Used when MoveToPosition is not given a speed for an axis
+	DefaultSpeed float64 `json:"default_speed_mm_per_sec"`
+}
+
+// Validate ensures all parts of the config are valid.
+func (conf *Config) Validate(path string) ([]string, error) {
+	if len(conf.Axes) == 0 {
+		return nil, errors.New("at least one axis is required")
+	}
+	if len(conf.Axes) > 3 {
+		return nil, errors.New("at most three axes are supported")
+	}
+	if conf.DefaultSpeed <= 0 {
+		return nil, errors.New("default_speed_mm_per_sec must be > 0")
+	}
+
+	var deps []string
+	for i, axis := range conf.Axes {
+		if axis.Motor == "" {
+			return nil, fmt.Errorf("axis %d: motor is required", i)
+		}
+		if axis.MmPerRev == 0 {
+			return nil, fmt.Errorf("axis %d: mm_per_rev must be nonzero", i)
+		}
+		if axis.LengthMm <= 0 {
+			return nil, fmt.Errorf("axis %d: length_mm must be > 0", i)
+		}
+		if axis.Acceleration <= 0 || axis.Deceleration <= 0 {
+			return nil, fmt.Errorf("axis %d: accel_mm_per_sec_squared and decel_mm_per_sec_squared must be > 0", i)
+		}
+		deps = append(deps, axis.Motor)
+	}
+	return deps, nil
+}
@@ -0,0 +1,226 @@
+package stgantry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/golang/geo/r3"
+	"go.uber.org/multierr"
+	"go.viam.com/rdk/components/gantry"
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/referenceframe"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/spatialmath"
+
+	"viam/viam-appliedmotion/coordinator"
+)
+
+var Model = resource.NewModel("viam", "appliedmotion", "st-gantry")
+
+// The direction each axis moves in the gantry's frame, in the order they're configured.
+var axisDirections = []r3.Vector{{X: 1}, {Y: 1}, {Z: 1}}
+
+type axis struct {
+	name     string
+	motor    motor.Motor
+	mmPerRev float64
+	lengthMm float64
+	accelMm  float64
+	decelMm  float64
+}
+
+type stGantry struct {
+	resource.Named
+	resource.AlwaysRebuild
+	resource.TriviallyCloseable
+	mu           sync.Mutex
+	logger       logging.Logger
+	axes         []axis
+	defaultSpeed float64
+	model        referenceframe.Model
+}
+
+func init() {
+	resource.RegisterComponent(
+		gantry.API,
+		Model,
+		resource.Registration[gantry.Gantry, *Config]{Constructor: newGantry})
+}
+
+func newGantry(
+	ctx context.Context, deps resource.Dependencies, conf resource.Config, logger logging.Logger,
+) (gantry.Gantry, error) {
+	newConf, err := resource.NativeConfig[*Config](conf)
+	if err != nil {
+		return nil, err
+	}
+
+	g := stGantry{
+		Named:        conf.ResourceName().AsNamed(),
+		logger:       logger,
+		defaultSpeed: newConf.DefaultSpeed,
+	}
+	for _, axisConf := range newConf.Axes {
+		m, err := motor.FromDependencies(deps, axisConf.Motor)
+		if err != nil {
+			return nil, err
+		}
+		g.axes = append(g.axes, axis{
+			name:     axisConf.Motor,
+			motor:    m,
+			mmPerRev: axisConf.MmPerRev,
+			lengthMm: axisConf.LengthMm,
+			accelMm:  axisConf.Acceleration,
+			decelMm:  axisConf.Deceleration,
+		})
+	}
+	return &g, nil
+}
+
+// Position returns the position of each axis in millimeters.
+func (g *stGantry) Position(ctx context.Context, extra map[string]interface{}) ([]float64, error) {
+	positions := make([]float64, len(g.axes))
+	for i, ax := range g.axes {
+		revs, err := ax.motor.Position(ctx, extra)
+		if err != nil {
+			return nil, fmt.Errorf("axis %s: %w", ax.name, err)
+		}
+		positions[i] = revs * ax.mmPerRev
+	}
+	return positions, nil
+}
+
+// Lengths returns the travel of each axis in millimeters.
+func (g *stGantry) Lengths(ctx context.Context, extra map[string]interface{}) ([]float64, error) {
+	lengths := make([]float64, len(g.axes))
+	for i, ax := range g.axes {
+		lengths[i] = ax.lengthMm
+	}
+	return lengths, nil
+}
+
+// MoveToPosition moves every axis to its target at the same time. Axes with less distance to
+// cover are slowed down, along with their accelerations, so that they all arrive together, at the
+// time the slowest axis would have taken at its requested speed. If a motor's limits would change
+// its planned speed or acceleration, the move fails rather than arriving out of step.
+func (g *stGantry) MoveToPosition(
+	ctx context.Context, positionsMm, speedsMmPerSec []float64, extra map[string]interface{},
+) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(positionsMm) != len(g.axes) {
+		return fmt.Errorf("need %d positions, got %d", len(g.axes), len(positionsMm))
+	}
+	if len(speedsMmPerSec) != 0 && len(speedsMmPerSec) != len(g.axes) {
+		return fmt.Errorf("need %d speeds (or none), got %d", len(g.axes), len(speedsMmPerSec))
+	}
+	for i, ax := range g.axes {
+		// These are soft limits: we refuse to drive the axis off either end of its travel.
+		if positionsMm[i] < 0 || positionsMm[i] > ax.lengthMm {
+			return fmt.Errorf("axis %s: position %f mm is outside of [0, %f]",
+				ax.name, positionsMm[i], ax.lengthMm)
+		}
+	}
+
+	axes := make([]coordinator.Axis, len(g.axes))
+	targets := make([]float64, len(g.axes))
+	for i, ax := range g.axes {
+		speed := g.defaultSpeed
+		if len(speedsMmPerSec) != 0 && speedsMmPerSec[i] > 0 {
+			speed = speedsMmPerSec[i]
+		}
+		revsPerMm := 1 / math.Abs(ax.mmPerRev)
+		axes[i] = coordinator.Axis{
+			Name:         ax.name,
+			Motor:        ax.motor,
+			Rpm:          speed * revsPerMm * 60,
+			Acceleration: ax.accelMm * revsPerMm,
+			Deceleration: ax.decelMm * revsPerMm,
+			Extra:        extra,
+		}
+		targets[i] = positionsMm[i] / ax.mmPerRev
+	}
+	_, err := coordinator.Move(ctx, axes, targets)
+	return err
+}
+
+// Home homes each axis in the order they are configured, using the home sensor set up on its st
+// motor.
+func (g *stGantry) Home(ctx context.Context, extra map[string]interface{}) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, ax := range g.axes {
+		g.logger.Infof("Homing axis %s", ax.name)
+		if _, err := ax.motor.DoCommand(ctx, map[string]interface{}{"command": "home"}); err != nil {
+			return false, fmt.Errorf("axis %s: %w", ax.name, err)
+		}
+	}
+	return true, nil
+}
+
+func (g *stGantry) Stop(ctx context.Context, extra map[string]interface{}) error {
+	var err error
+	for _, ax := range g.axes {
+		err = multierr.Combine(err, ax.motor.Stop(ctx, extra))
+	}
+	return err
+}
+
+func (g *stGantry) IsMoving(ctx context.Context) (bool, error) {
+	for _, ax := range g.axes {
+		moving, err := ax.motor.IsMoving(ctx)
+		if err != nil || moving {
+			return moving, err
+		}
+	}
+	return false, nil
+}
+
+// ModelFrame returns a frame with one translational joint per axis, along X, Y and Z in that
+// order.
+func (g *stGantry) ModelFrame() referenceframe.Model {
+	if g.model == nil {
+		var errs error
+		model := referenceframe.NewSimpleModel("")
+		f, err := referenceframe.NewStaticFrame(g.Name().ShortName(), spatialmath.NewZeroPose())
+		errs = multierr.Combine(errs, err)
+		model.OrdTransforms = append(model.OrdTransforms, f)
+		for i, ax := range g.axes {
+			f, err := referenceframe.NewTranslationalFrame(
+				ax.name, axisDirections[i], referenceframe.Limit{Min: 0, Max: ax.lengthMm})
+			errs = multierr.Combine(errs, err)
+			model.OrdTransforms = append(model.OrdTransforms, f)
+		}
+		if errs != nil {
+			g.logger.Error(errs)
+			return nil
+		}
+		g.model = model
+	}
+	return g.model
+}
+
+func (g *stGantry) CurrentInputs(ctx context.Context) ([]referenceframe.Input, error) {
+	positions, err := g.Position(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return referenceframe.FloatsToInputs(positions), nil
+}
+
+func (g *stGantry) GoToInputs(ctx context.Context, inputSteps ...[]referenceframe.Input) error {
+	for _, goal := range inputSteps {
+		if err := g.MoveToPosition(ctx, referenceframe.InputsToFloats(goal), nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *stGantry) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	return nil, resource.ErrDoUnimplemented
+}
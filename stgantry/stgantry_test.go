@@ -0,0 +1,130 @@
+package stgantry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/components/gantry"
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+
+	"viam/viam-appliedmotion/common"
+)
+
+// fakeMotor is a motor that jumps straight to wherever it's sent, and records when it's homed.
+type fakeMotor struct {
+	motor.Motor
+	name     string
+	position float64
+	rpm      float64
+	extra    map[string]interface{}
+	homed    *[]string
+}
+
+func (m *fakeMotor) Position(ctx context.Context, extra map[string]interface{}) (float64, error) {
+	return m.position, nil
+}
+
+func (m *fakeMotor) GoTo(ctx context.Context, rpm, position float64, extra map[string]interface{}) error {
+	m.rpm, m.position, m.extra = rpm, position, extra
+	return nil
+}
+
+func (m *fakeMotor) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	*m.homed = append(*m.homed, m.name)
+	return nil, nil
+}
+
+func newTestGantry(t *testing.T) (gantry.Gantry, []*fakeMotor, *[]string) {
+	var homed []string
+	motors := []*fakeMotor{
+		{name: "x", homed: &homed},
+		{name: "y", homed: &homed},
+	}
+	deps := resource.Dependencies{}
+	for _, m := range motors {
+		deps[motor.Named(m.name)] = m
+	}
+	conf := resource.Config{
+		Name:  "gantry",
+		API:   gantry.API,
+		Model: Model,
+		ConvertedAttributes: &Config{
+			Axes: []AxisConfig{
+				{Motor: "y", MmPerRev: 5, LengthMm: 100, Acceleration: 50, Deceleration: 50},
+				{Motor: "x", MmPerRev: -8, LengthMm: 200, Acceleration: 80, Deceleration: 40},
+			},
+			DefaultSpeed: 10,
+		},
+	}
+	g, err := newGantry(context.Background(), deps, conf, logging.NewTestLogger(t))
+	assert.Nil(t, err)
+	return g, motors, &homed
+}
+
+func TestGantryScaling(t *testing.T) {
+	ctx := context.Background()
+	g, motors, _ := newTestGantry(t)
+	x, y := motors[0], motors[1]
+
+	lengths, err := g.Lengths(ctx, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{100, 200}, lengths)
+
+	// A negative mm_per_rev turns the motor the other way, but still at a positive speed.
+	assert.Nil(t, g.MoveToPosition(ctx, []float64{50, 80}, []float64{20, 0}, nil))
+	assert.Equal(t, 10.0, y.position)
+	assert.Equal(t, -10.0, x.position)
+	assert.Greater(t, x.rpm, 0.0)
+	assert.Greater(t, y.rpm, 0.0)
+
+	positions, err := g.Position(ctx, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{50, 80}, positions)
+}
+
+func TestGantryArrivesTogether(t *testing.T) {
+	ctx := context.Background()
+	g, motors, _ := newTestGantry(t)
+	x, y := motors[0], motors[1]
+
+	// y has 2 revolutions to go at 2 revs/sec and 10 revs/sec^2, which takes 1.2 seconds, and x
+	// would be done much sooner, so it's slowed down to match. Every axis gets its acceleration in
+	// its motor's units, and st motors are asked to refuse the move rather than bound it.
+	assert.Nil(t, g.MoveToPosition(ctx, []float64{10, 0.8}, nil, map[string]interface{}{"run_current": 2.0}))
+	for _, m := range []*fakeMotor{x, y} {
+		assert.Equal(t, true, m.extra["strict_limits"], m.name)
+		assert.Equal(t, 2.0, m.extra["run_current"], m.name)
+		accel := m.extra["acceleration"].(float64)
+		decel := m.extra["deceleration"].(float64)
+		duration := common.TrapezoidDuration(m.position, m.rpm/60, accel, decel)
+		assert.InDelta(t, 1.2, duration, 1e-9, m.name)
+	}
+	assert.Equal(t, 10.0, y.extra["acceleration"])
+	assert.Less(t, x.extra["acceleration"], 10.0)
+}
+
+func TestGantrySoftLimits(t *testing.T) {
+	ctx := context.Background()
+	g, motors, _ := newTestGantry(t)
+
+	assert.ErrorContains(t, g.MoveToPosition(ctx, []float64{101, 0}, nil, nil), "outside of [0, 100")
+	assert.ErrorContains(t, g.MoveToPosition(ctx, []float64{0, -1}, nil, nil), "outside of [0, 200")
+	assert.ErrorContains(t, g.MoveToPosition(ctx, []float64{0}, nil, nil), "need 2 positions")
+	for _, m := range motors {
+		assert.Equal(t, 0.0, m.position, "nothing should have moved")
+	}
+
+	// The ends of the travel themselves are fine.
+	assert.Nil(t, g.MoveToPosition(ctx, []float64{100, 200}, nil, nil))
+}
+
+func TestGantryHomeOrder(t *testing.T) {
+	g, _, homed := newTestGantry(t)
+	ok, err := g.Home(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"y", "x"}, *homed, "axes should be homed in the order they're configured")
+}